@@ -0,0 +1,184 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultCompressLevel is the gzip level of .tar.gz archives unless
+// --compress-level says otherwise; it balances CPU time against size.
+const defaultCompressLevel = 6
+
+// Archive bundles downloaded files into a single tar, tar.gz or zip file.
+// Entry names mirror the layout under the output directory. A nil *Archive is
+// valid and discards everything.
+type Archive struct {
+	mu     sync.Mutex
+	file   *os.File
+	gz     *gzip.Writer
+	tw     *tar.Writer
+	zw     *zip.Writer
+	count  int
+	errors []error
+
+	// inputBytes is the total size of the files added, for the compression
+	// ratio.
+	inputBytes int64
+}
+
+// isGzipArchive reports whether path names a .tar.gz or .tgz archive, the
+// only format --compress-level applies to.
+func isGzipArchive(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+func openArchive(path string) (*Archive, error) {
+	lower := strings.ToLower(path)
+	isTarGz := isGzipArchive(path)
+	isTar := strings.HasSuffix(lower, ".tar")
+	isZip := strings.HasSuffix(lower, ".zip")
+	if !isTarGz && !isTar && !isZip {
+		return nil, fmt.Errorf("unsupported archive format %q (use .tar, .tar.gz, .tgz or .zip)", path)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{file: f}
+	switch {
+	case isZip:
+		a.zw = zip.NewWriter(f)
+	case isTarGz:
+		if a.gz, err = gzip.NewWriterLevel(f, compressLevel); err != nil {
+			f.Close()
+			return nil, err
+		}
+		a.tw = tar.NewWriter(a.gz)
+	default:
+		a.tw = tar.NewWriter(f)
+	}
+	return a, nil
+}
+
+// Add copies the file at fullPath into the archive. Failures are collected
+// and reported by Close so they don't interrupt the batch.
+func (a *Archive) Add(fullPath string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.add(fullPath); err != nil {
+		a.errors = append(a.errors, fmt.Errorf("%s: %w", fullPath, err))
+		return
+	}
+	a.count++
+}
+
+func (a *Archive) add(fullPath string) error {
+	name, err := filepath.Rel(outputDir, fullPath)
+	if err != nil {
+		name = fullPath
+	}
+	name = filepath.ToSlash(name)
+
+	src, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	var dst io.Writer
+	if a.zw != nil {
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		// Parquet is already compressed; storing avoids wasting CPU.
+		hdr.Method = zip.Store
+		if dst, err = a.zw.CreateHeader(hdr); err != nil {
+			return err
+		}
+	} else {
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if err := a.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		dst = a.tw
+	}
+
+	n, err := io.Copy(dst, src)
+	a.inputBytes += n
+	return err
+}
+
+// Close finalizes the archive and returns the number of files written along
+// with any per-file errors collected by Add.
+func (a *Archive) Close() (int, []error) {
+	if a == nil {
+		return 0, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	errs := a.errors
+	if a.zw != nil {
+		if err := a.zw.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.tw != nil {
+		if err := a.tw.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.gz != nil {
+		if err := a.gz.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := a.file.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return a.count, errs
+}
+
+// CompressionRatio returns the total size of the archived files divided by
+// the size of the finished archive, or 0 if either is unknown. Call it after
+// Close.
+func (a *Archive) CompressionRatio() float64 {
+	if a == nil || a.inputBytes == 0 {
+		return 0
+	}
+	info, err := os.Stat(a.file.Name())
+	if err != nil || info.Size() == 0 {
+		return 0
+	}
+	return float64(a.inputBytes) / float64(info.Size())
+}
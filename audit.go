@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditEntry is one line of the --audit-log. Link fetches and downloads share
+// the type; fields that don't apply to an event are omitted.
+type auditEntry struct {
+	Timestamp    string  `json:"timestamp"`
+	Event        string  `json:"event"` // "link", "download" or "download_chunk"
+	URL          string  `json:"url,omitempty"`
+	Host         string  `json:"host,omitempty"`
+	Range        string  `json:"range,omitempty"`
+	Status       int     `json:"status,omitempty"`
+	LatencyMs    float64 `json:"latency_ms,omitempty"`  // Link fetches
+	DurationMs   float64 `json:"duration_ms,omitempty"` // Downloads
+	DownloadHost string  `json:"download_host,omitempty"`
+	FileSize     int64   `json:"file_size,omitempty"`
+	Bytes        int64   `json:"bytes,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// AuditLog records request and response metadata of every link fetch and
+// download as JSON lines, for attaching to a support ticket. A nil *AuditLog
+// is valid and records nothing.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// runAudit is the --audit-log of the current invocation.
+var runAudit *AuditLog
+
+func openAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (a *AuditLog) record(entry auditEntry, start time.Time, err error) {
+	if a == nil {
+		return
+	}
+	entry.Timestamp = start.UTC().Format(time.RFC3339Nano)
+	elapsed := float64(time.Since(start).Microseconds()) / 1000
+	if entry.Event == "link" {
+		entry.LatencyMs = elapsed
+	} else {
+		entry.DurationMs = elapsed
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_ = a.enc.Encode(entry)
+}
+
+// LinkFetch records a download-link request to the API.
+func (a *AuditLog) LinkFetch(requestURL string, start time.Time, status int, downloadURL string, fileSize int64, err error) {
+	a.record(auditEntry{
+		Event:        "link",
+		URL:          redactURL(requestURL),
+		Status:       status,
+		DownloadHost: hostOf(downloadURL),
+		FileSize:     fileSize,
+	}, start, err)
+}
+
+// Download records a (possibly ranged) file download from the CDN.
+func (a *AuditLog) Download(event, downloadURL, byteRange string, start time.Time, status int, bytes int64, err error) {
+	a.record(auditEntry{
+		Event:  event,
+		Host:   hostOf(downloadURL),
+		Range:  byteRange,
+		Status: status,
+		Bytes:  bytes,
+	}, start, err)
+}
+
+func (a *AuditLog) Close() {
+	if a == nil {
+		return
+	}
+	_ = a.file.Close()
+}
+
+// redactedParams are query parameters whose values never reach the audit log.
+var redactedParams = []string{"api_key", "apikey", "key", "token", "x-api-key"}
+
+// redactURL masks credentials that may appear in a URL's query string.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	changed := false
+	for name := range q {
+		for _, secret := range redactedParams {
+			if strings.EqualFold(name, secret) {
+				q.Set(name, "REDACTED")
+				changed = true
+			}
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// hostOf returns the host of a URL, or "" if it can't be parsed.
+func hostOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// availabilityManifest is the file written by --output-manifest-only: what
+// the server has for every job, without any file data being downloaded.
+type availabilityManifest struct {
+	GeneratedAt time.Time           `json:"generated_at"`
+	Type        string              `json:"type"`
+	Available   int                 `json:"available"`
+	Missing     int                 `json:"missing"`
+	Errors      int                 `json:"errors"`
+	TotalSize   int64               `json:"total_size"` // Bytes, of the available files
+	Files       []availabilityEntry `json:"files"`
+}
+
+type availabilityEntry struct {
+	Exchange      string    `json:"exchange"`
+	Pair          string    `json:"pair"`
+	Date          string    `json:"date"`
+	ServerPath    string    `json:"server_path"`
+	LocalPath     string    `json:"local_path"`
+	Status        string    `json:"status"` // "available", "missing" (404) or "error"
+	Size          int64     `json:"size,omitempty"`
+	LinkExpiresAt time.Time `json:"link_expires_at,omitzero"` // Zero if the link doesn't say
+	Error         string    `json:"error,omitempty"`
+}
+
+// writeAvailabilityManifest fetches the download link of every job and
+// writes the size, link expiry or 404 of each file to path, downloading
+// nothing. Links are stored in the --link-cache, if one is set.
+func writeAvailabilityManifest(jobs []Job, path string) {
+	spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Fetching links of %d files...", len(jobs)))
+
+	m := availabilityManifest{
+		GeneratedAt: time.Now().UTC(),
+		Type:        dataType,
+		Files:       make([]availabilityEntry, len(jobs)),
+	}
+	forEachParallel(len(jobs), parallelism, func(idx int) {
+		job := jobs[idx]
+		entry := availabilityEntry{
+			Exchange:   job.Exchange,
+			Pair:       job.Pair,
+			Date:       job.Date.Format(serverDateFormat),
+			ServerPath: job.RelPath,
+			LocalPath:  job.FullPath,
+		}
+		link, size, err := cachedDownloadLink(job.RelPath)
+		switch {
+		case errors.Is(err, errFileNotFound):
+			entry.Status = "missing"
+		case err != nil:
+			entry.Status = "error"
+			entry.Error = err.Error()
+		default:
+			entry.Status = "available"
+			entry.Size = size
+			entry.LinkExpiresAt = linkExpiry(link)
+		}
+		m.Files[idx] = entry
+	})
+	_ = spinner.Stop()
+	saveLinkCache()
+
+	for _, entry := range m.Files {
+		switch entry.Status {
+		case "available":
+			m.Available++
+			m.TotalSize += entry.Size
+		case "missing":
+			m.Missing++
+		default:
+			m.Errors++
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(path, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		pterm.Error.Printf("Failed to write manifest: %v\n", err)
+		os.Exit(1)
+	}
+
+	pterm.Success.Printf("Wrote the availability of %d files to %s.\n", len(jobs), path)
+	pterm.Info.Printf("Available: %d files, %s total\n", m.Available, formatSize(m.TotalSize))
+	if m.Missing > 0 {
+		pterm.Warning.Printf("Missing on server: %d files\n", m.Missing)
+	}
+	if m.Errors > 0 {
+		pterm.Warning.Printf("Could not be checked: %d files\n", m.Errors)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchType        string
+	benchDate        string
+	benchExchanges   []string
+	benchTokens      []string
+	benchCount       int
+	benchConcurrency []int
+)
+
+func newBenchmarkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "benchmark",
+		Short: "Measure download throughput at several concurrency levels",
+		Long: `Downloads the same set of files once per concurrency level, discarding the
+data, and compares link-fetch latency, throughput and total time, to help
+choose --parallel for a network. Nothing is written to disk.`,
+		Run: runBenchmark,
+	}
+	cmd.Flags().StringVar(&benchType, "type", "trade", "Data type: "+strings.Join(supportedDataTypes(), ", "))
+	cmd.Flags().StringVar(&benchDate, "date", "", "Date (YYYY-MM-DD) of the files to download (default yesterday, UTC)")
+	cmd.Flags().StringSliceVar(&benchExchanges, "exchanges", nil, "Exchanges to take files from")
+	cmd.Flags().StringSliceVar(&benchTokens, "tokens", nil, "Only take these pairs (default all pairs of the exchanges)")
+	cmd.Flags().IntVar(&benchCount, "count", 8, "Number of files downloaded at each concurrency level")
+	cmd.Flags().IntSliceVar(&benchConcurrency, "concurrency", []int{1, 2, 4, 8}, "Concurrency levels to compare")
+	_ = cmd.MarkFlagRequired("exchanges")
+	return cmd
+}
+
+// benchmarkSample is the timing of one file at one concurrency level.
+type benchmarkSample struct {
+	linkLatency time.Duration
+	download    time.Duration
+	bytes       int64
+	err         error
+}
+
+// benchmarkResult sums up one concurrency level.
+type benchmarkResult struct {
+	concurrency int
+	elapsed     time.Duration
+	samples     []benchmarkSample
+}
+
+func runBenchmark(cmd *cobra.Command, args []string) {
+	if _, ok := dataTypeFileParts[benchType]; !ok {
+		pterm.Error.Printf("Unknown data type: %s. Supported types: %s\n", benchType, strings.Join(supportedDataTypes(), ", "))
+		os.Exit(1)
+	}
+	if benchCount <= 0 {
+		pterm.Error.Println("--count must be positive")
+		os.Exit(1)
+	}
+	if len(benchConcurrency) == 0 || slices.ContainsFunc(benchConcurrency, func(c int) bool { return c <= 0 }) {
+		pterm.Error.Println("--concurrency must list positive levels")
+		os.Exit(1)
+	}
+
+	date := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	if benchDate != "" {
+		var err error
+		date, err = time.Parse(serverDateFormat, benchDate)
+		if err != nil {
+			pterm.Error.Printf("Invalid date: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	rules, err := loadConfigRules(benchType)
+	if err != nil {
+		pterm.Error.Printf("Failed to load metadata configurations: %v\n", err)
+		os.Exit(1)
+	}
+	relPaths := benchmarkFiles(getConfigForDate(rules, date), date)
+	if len(relPaths) == 0 {
+		pterm.Error.Printf("No %s files on %s for the given exchanges and tokens.\n", benchType, date.Format(serverDateFormat))
+		os.Exit(1)
+	}
+
+	if err := loadUserConfig(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if _, err := loadAPIKeySource(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("API_KEY")
+	}
+	if err := checkAPIKey(apiKey); err != nil {
+		pterm.Warning.Printf("%v; requests will likely be rejected\n", err)
+	}
+
+	pterm.DefaultSection.Println("Benchmark")
+	pterm.Info.Printf("Files: %d %s files from %s\n", len(relPaths), benchType, date.Format(serverDateFormat))
+	pterm.Info.Printf("Concurrency levels: %s\n", joinInts(benchConcurrency))
+	pterm.Println()
+
+	var results []benchmarkResult
+	for _, c := range benchConcurrency {
+		spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Downloading %d files with concurrency %d...", len(relPaths), c))
+		result := runBenchmarkLevel(relPaths, c)
+		_ = spinner.Stop()
+		results = append(results, result)
+	}
+	printBenchmark(results)
+}
+
+// benchmarkFiles picks up to --count files of the requested exchanges and
+// tokens from config, in a stable order.
+func benchmarkFiles(config map[string][]string, date time.Time) []string {
+	var relPaths []string
+	for _, ex := range slices.Sorted(slices.Values(trimAll(benchExchanges))) {
+		pairs := slices.Sorted(slices.Values(config[ex]))
+		for _, pair := range pairs {
+			if len(benchTokens) > 0 && !contains(trimAll(benchTokens), pair) {
+				continue
+			}
+			relPaths = append(relPaths, getRelativePath(ex, pair, benchType, date))
+		}
+	}
+	return relPaths[:min(len(relPaths), benchCount)]
+}
+
+// runBenchmarkLevel downloads every file with the given number of workers.
+func runBenchmarkLevel(relPaths []string, concurrency int) benchmarkResult {
+	result := benchmarkResult{concurrency: concurrency, samples: make([]benchmarkSample, len(relPaths))}
+	start := time.Now()
+	forEachParallel(len(relPaths), concurrency, func(idx int) {
+		result.samples[idx] = benchmarkFile(relPaths[idx])
+	})
+	result.elapsed = time.Since(start)
+	return result
+}
+
+// benchmarkFile fetches the link of relPath and downloads the file into
+// io.Discard, timing both steps.
+func benchmarkFile(relPath string) benchmarkSample {
+	var s benchmarkSample
+	start := time.Now()
+	link, _, err := fetchDownloadLink(apiKey, relPath)
+	s.linkLatency = time.Since(start)
+	if err != nil {
+		s.err = err
+		return s
+	}
+
+	start = time.Now()
+	resp, err := http.Get(link)
+	if err != nil {
+		s.err = err
+		return s
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		s.err = &StatusError{StatusCode: resp.StatusCode}
+		return s
+	}
+	s.bytes, s.err = io.Copy(io.Discard, resp.Body)
+	s.download = time.Since(start)
+	return s
+}
+
+func printBenchmark(results []benchmarkResult) {
+	tableData := [][]string{{"Concurrency", "Files", "Failed", "Data", "Time", "Throughput", "Link p50", "Link p90", "Link max", "Per file"}}
+	best := -1
+	var bestRate float64
+	for i, r := range results {
+		var bytes int64
+		var failed int
+		var latencies []time.Duration
+		var perFile float64
+		for _, s := range r.samples {
+			latencies = append(latencies, s.linkLatency)
+			if s.err != nil {
+				failed++
+				continue
+			}
+			bytes += s.bytes
+			if s.download > 0 {
+				perFile += float64(s.bytes) / s.download.Seconds()
+			}
+		}
+		ok := len(r.samples) - failed
+		if ok > 0 {
+			perFile /= float64(ok)
+		}
+		rate := float64(bytes) / r.elapsed.Seconds()
+		if failed == 0 && rate > bestRate {
+			best, bestRate = i, rate
+		}
+		slices.Sort(latencies)
+		tableData = append(tableData, []string{
+			strconv.Itoa(r.concurrency),
+			strconv.Itoa(len(r.samples)),
+			strconv.Itoa(failed),
+			formatSize(bytes),
+			r.elapsed.Round(time.Millisecond).String(),
+			formatSize(int64(rate)) + "/s",
+			percentile(latencies, 50).Round(time.Millisecond).String(),
+			percentile(latencies, 90).Round(time.Millisecond).String(),
+			latencies[len(latencies)-1].Round(time.Millisecond).String(),
+			formatSize(int64(perFile)) + "/s",
+		})
+	}
+
+	renderTable(pterm.DefaultTable.
+		WithHasHeader().
+		WithBoxed().
+		WithData(tableData))
+
+	pterm.Println()
+	for _, r := range results {
+		for _, s := range r.samples {
+			if s.err != nil {
+				pterm.Warning.Printf("Concurrency %d: %v\n", r.concurrency, s.err)
+			}
+		}
+	}
+	if best < 0 {
+		pterm.Warning.Println("No concurrency level downloaded every file; see the failures above.")
+		return
+	}
+	pterm.Success.Printf("Highest throughput: %s/s with concurrency %d (use --parallel %d)\n",
+		formatSize(int64(bestRate)), results[best].concurrency, results[best].concurrency)
+}
+
+// percentile returns the p-th percentile of sorted durations, by the nearest
+// rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ", ")
+}
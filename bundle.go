@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// Bundle is a shareable dataset specification read from --bundle. It names
+// the exchanges, tokens and date range of a pull so everyone running it gets
+// the same files. The range is either absolute (start_date, optionally
+// end_date) or a rolling window of last_days ending yesterday.
+type Bundle struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	Mode        string   `json:"mode"`
+	Exchanges   []string `json:"exchanges"`
+	Tokens      []string `json:"tokens"`
+	StartDate   string   `json:"start_date"`
+	EndDate     string   `json:"end_date"`
+	LastDays    int      `json:"last_days"`
+}
+
+var errInvalidBundle = errors.New("invalid bundle")
+
+// loadBundle reads and validates the bundle at path. Unknown fields are
+// rejected so that typos don't silently change the pull.
+func loadBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var b Bundle
+	if err := dec.Decode(&b); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidBundle, path, err)
+	}
+	if err := expandBundleEnv(&b); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidBundle, path, err)
+	}
+	if err := b.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidBundle, path, err)
+	}
+	return &b, nil
+}
+
+func (b *Bundle) validate() error {
+	if b.Type != "" {
+		if _, ok := dataTypeFileParts[b.Type]; !ok {
+			return fmt.Errorf("unknown type %q (supported: %s)", b.Type, strings.Join(supportedDataTypes(), ", "))
+		}
+	}
+	if b.Mode != "" && b.Mode != "day" && b.Mode != "check" {
+		return fmt.Errorf("unknown mode %q (supported: day, check)", b.Mode)
+	}
+	if b.Mode != "check" && (len(b.Exchanges) == 0 || len(b.Tokens) == 0) {
+		return errors.New("exchanges and tokens are required")
+	}
+
+	switch {
+	case b.LastDays < 0:
+		return errors.New("last_days must be positive")
+	case b.LastDays > 0 && (b.StartDate != "" || b.EndDate != ""):
+		return errors.New("last_days cannot be combined with start_date or end_date")
+	case b.LastDays == 0 && b.StartDate == "":
+		return errors.New("either start_date or last_days is required")
+	}
+	for _, d := range []string{b.StartDate, b.EndDate} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(serverDateFormat, d); err != nil {
+			return fmt.Errorf("invalid date %q: expected YYYY-MM-DD", d)
+		}
+	}
+	return nil
+}
+
+// applyBundle fills the run's flags from the bundle. Flags given on the
+// command line take precedence.
+func applyBundle(cmd *cobra.Command, b *Bundle) {
+	setString := func(flag string, dst *string, val string) {
+		if val != "" && !cmd.Flags().Changed(flag) {
+			*dst = val
+		}
+	}
+	setList := func(flag string, dst *[]string, val []string) {
+		if len(val) > 0 && !cmd.Flags().Changed(flag) {
+			*dst = val
+		}
+	}
+	setString("type", &dataType, b.Type)
+	setString("mode", &mode, b.Mode)
+	setList("exchanges", &exchanges, b.Exchanges)
+	setList("tokens", &tokens, b.Tokens)
+
+	start, end := b.StartDate, b.EndDate
+	if b.LastDays > 0 {
+		yesterday := today().AddDate(0, 0, -1)
+		start = yesterday.AddDate(0, 0, 1-b.LastDays).Format(serverDateFormat)
+		end = yesterday.Format(serverDateFormat)
+	}
+	if !cmd.Flags().Changed("start-date") && !cmd.Flags().Changed("end-date") {
+		startDate, endDate = start, end
+	}
+}
+
+// printBundle reports what a bundle expands to.
+func printBundle(b *Bundle) {
+	name := b.Name
+	if name == "" {
+		name = bundlePath
+	}
+	pterm.DefaultSection.Println("Bundle: " + name)
+	if b.Description != "" {
+		pterm.Println(b.Description)
+	}
+	rangeStr := startDate
+	if endDate != "" {
+		rangeStr += " to " + endDate
+	}
+	if b.LastDays > 0 {
+		rangeStr += fmt.Sprintf(" (last %d days)", b.LastDays)
+	}
+	pterm.Info.Printf("Mode: %s, Type: %s\n", mode, dataType)
+	pterm.Info.Printf("Exchanges: %s\n", strings.Join(exchanges, ", "))
+	pterm.Info.Printf("Tokens: %s\n", strings.Join(tokens, ", "))
+	pterm.Info.Printf("Range: %s\n", rangeStr)
+	pterm.Println()
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// minBundleJobs is how many files of one exchange and date must be missing
+// locally before --bundle-download fetches their bundle; a single file is
+// cheaper to download on its own.
+const minBundleJobs = 2
+
+var errInvalidBundlePath = errors.New("invalid --bundle-path-template")
+
+// bundlePathPlaceholders are the placeholders of --bundle-path-template.
+var bundlePathPlaceholders = []string{"{exchange}", "{type}", "{file_part}", "{date}", "{yyyy}", "{mm}", "{dd}"}
+
+// validateBundlePathTemplate checks that tmpl names one archive per exchange
+// and day.
+func validateBundlePathTemplate(tmpl string) error {
+	rest := tmpl
+	for _, p := range bundlePathPlaceholders {
+		rest = strings.ReplaceAll(rest, p, "")
+	}
+	switch {
+	case strings.ContainsAny(rest, "{}"):
+		return fmt.Errorf("%w: unknown placeholder in %q (supported: %s)", errInvalidBundlePath, tmpl, strings.Join(bundlePathPlaceholders, ", "))
+	case !strings.Contains(tmpl, "{exchange}"):
+		return fmt.Errorf("%w: %q has no {exchange}", errInvalidBundlePath, tmpl)
+	case !strings.Contains(tmpl, "{date}") && !(strings.Contains(tmpl, "{yyyy}") && strings.Contains(tmpl, "{mm}") && strings.Contains(tmpl, "{dd}")):
+		return fmt.Errorf("%w: %q has no {date}, nor {yyyy}, {mm} and {dd}", errInvalidBundlePath, tmpl)
+	case !strings.HasSuffix(tmpl, ".tar.gz") && !strings.HasSuffix(tmpl, ".tgz"):
+		return fmt.Errorf("%w: %q must end in .tar.gz or .tgz", errInvalidBundlePath, tmpl)
+	}
+	return nil
+}
+
+// bundleRelPath returns the server path of the archive that holds the files
+// of every pair of exchange on date, from --bundle-path-template.
+func bundleRelPath(exchange, dType string, date time.Time) string {
+	filePart, ok := dataTypeFileParts[dType]
+	if !ok {
+		filePart = dType
+	}
+	y, m, d := date.Date()
+	return strings.NewReplacer(
+		"{exchange}", exchange,
+		"{type}", dType,
+		"{file_part}", filePart,
+		"{date}", date.Format(serverDateFormat),
+		"{yyyy}", fmt.Sprintf("%04d", y),
+		"{mm}", fmt.Sprintf("%02d", m),
+		"{dd}", fmt.Sprintf("%02d", d),
+	).Replace(bundlePathTemplate)
+}
+
+// Bundles hands out the files of the --bundle-download bundles to the jobs of
+// a batch. A bundle is fetched by the first of its jobs to run, under the
+// scheduler like any download, and its files are extracted to a staging
+// folder from which each job takes its own. A nil *Bundles is valid and
+// serves nothing.
+type Bundles struct {
+	byPath map[string]*bundleGroup // Jobs' local paths to their bundle
+
+	mu         sync.Mutex
+	fetched    int
+	notOffered int
+	failed     []error
+	bytes      int64
+	taken      int
+}
+
+// bundleGroup is the jobs of one exchange and date that a bundle may serve.
+type bundleGroup struct {
+	relPath string
+	members map[string]string // Name of the file in the archive to the local path of its job
+
+	once   sync.Once
+	dir    string           // Staging folder of the extracted files
+	staged map[string]int64 // Local paths to the size of their extracted file
+}
+
+// runBundles is the bundle set of the current batch, nil without
+// --bundle-download.
+var runBundles *Bundles
+
+// newBundles groups the jobs whose files are missing locally by the bundle
+// that holds them, keeping the bundles with at least minBundleJobs of them.
+func newBundles(jobs []Job) *Bundles {
+	groups := make(map[string]*bundleGroup)
+	for _, job := range jobs {
+		if fileExists(job.FullPath) || isFIFO(job.FullPath) {
+			continue
+		}
+		relPath := bundleRelPath(job.Exchange, dataType, job.Date)
+		g := groups[relPath]
+		if g == nil {
+			g = &bundleGroup{relPath: relPath, members: make(map[string]string)}
+			groups[relPath] = g
+		}
+		g.members[path.Base(job.RelPath)] = job.FullPath
+	}
+	b := &Bundles{byPath: make(map[string]*bundleGroup)}
+	for _, g := range groups {
+		if len(g.members) < minBundleJobs {
+			continue
+		}
+		for _, fullPath := range g.members {
+			b.byPath[fullPath] = g
+		}
+	}
+	return b
+}
+
+// Take moves the file of job out of its bundle into place, fetching the
+// bundle first if no other job of it has. It returns the size of the file,
+// and false if the job is to download its file on its own: it has no
+// bundle, the server doesn't offer the bundle, or the bundle lacks the file.
+func (b *Bundles) Take(job Job, jobLabel string) (int64, bool) {
+	if b == nil {
+		return 0, false
+	}
+	g := b.byPath[job.FullPath]
+	if g == nil {
+		return 0, false
+	}
+	job.Bar.UpdateTitle(fmt.Sprintf("%s %s ... Fetching bundle", pterm.LightBlue("LOADING"), jobLabel))
+	g.once.Do(func() { b.fetch(g, job.Bar) })
+
+	b.mu.Lock()
+	size, ok := g.staged[job.FullPath]
+	delete(g.staged, job.FullPath)
+	b.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	staged := filepath.Join(g.dir, path.Base(job.RelPath))
+	err := mkdirOutput(filepath.Dir(job.FullPath))
+	if err == nil {
+		err = os.Rename(staged, job.FullPath)
+	}
+	if err != nil {
+		_ = os.Remove(staged)
+		return 0, false
+	}
+	b.mu.Lock()
+	b.taken++
+	b.mu.Unlock()
+	return size, true
+}
+
+// fetch downloads the bundle of g, with its progress on bar, and extracts
+// the files of g's jobs into a staging folder of the output directory.
+func (b *Bundles) fetch(g *bundleGroup, bar *pterm.ProgressbarPrinter) {
+	err := b.fetchBundle(g, bar)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case errors.Is(err, errFileNotFound):
+		b.notOffered++
+	case err != nil:
+		b.failed = append(b.failed, fmt.Errorf("%s: %w", g.relPath, err))
+	default:
+		b.fetched++
+	}
+}
+
+func (b *Bundles) fetchBundle(g *bundleGroup, bar *pterm.ProgressbarPrinter) error {
+	link, size, err := cachedDownloadLink(g.relPath)
+	if err != nil {
+		return err
+	}
+	if err := mkdirOutput(outputDir); err != nil {
+		return err
+	}
+	if g.dir, err = os.MkdirTemp(outputDir, ".bundle-"); err != nil {
+		return err
+	}
+	archivePath := filepath.Join(g.dir, path.Base(g.relPath))
+	bar.Current = 0
+	setBarTotal(bar, size)
+	written, _, err := download(link, archivePath, size, progressBarFor(bar, size))
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	b.mu.Lock()
+	b.bytes += written
+	b.mu.Unlock()
+
+	staged := make(map[string]int64, len(g.members))
+	err = extractBundle(archivePath, func(name string, r io.Reader) error {
+		fullPath, ok := g.members[path.Base(name)]
+		if !ok {
+			return nil
+		}
+		written, err := extractBundleFile(r, filepath.Join(g.dir, path.Base(name)))
+		if err != nil {
+			return fmt.Errorf("extracting %s: %w", name, err)
+		}
+		staged[fullPath] = written
+		return nil
+	})
+	_ = os.Remove(archivePath)
+	b.mu.Lock()
+	g.staged = staged
+	b.mu.Unlock()
+	return err
+}
+
+// Close removes the staging folders, with any files no job took, and reports
+// what the bundles achieved.
+func (b *Bundles) Close() {
+	if b == nil {
+		return
+	}
+	seen := make(map[*bundleGroup]bool)
+	for _, g := range b.byPath {
+		if !seen[g] && g.dir != "" {
+			_ = os.RemoveAll(g.dir)
+		}
+		seen[g] = true
+	}
+	if b.fetched+b.notOffered+len(b.failed) == 0 {
+		return
+	}
+
+	pterm.Println()
+	for _, err := range b.failed {
+		pterm.Warning.Printf("Bundle %v; its files were downloaded one by one\n", err)
+	}
+	if b.fetched > 0 {
+		pterm.Info.Printf("Bundles: %d fetched (%s, %d files extracted), %d not offered, %d failed\n",
+			b.fetched, formatSize(b.bytes), b.taken, b.notOffered, len(b.failed))
+	} else {
+		pterm.Info.Printf("Bundles: none fetched, %d not offered, %d failed\n", b.notOffered, len(b.failed))
+	}
+}
+
+// extractBundle calls extract with every regular file of the .tar.gz
+// archive at archivePath.
+func extractBundle(archivePath string, extract func(name string, r io.Reader) error) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("not a .tar.gz archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extract(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// extractBundleFile writes one file of a bundle to fullPath. Like a
+// download, it goes to a .part file first and is only renamed into place
+// once complete and valid parquet.
+func extractBundleFile(r io.Reader, fullPath string) (int64, error) {
+	if err := mkdirOutput(filepath.Dir(fullPath)); err != nil {
+		return 0, err
+	}
+	partPath := fullPath + partSuffix
+	f, err := openOutputFile(partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, defaultFileMode)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.CopyBuffer(f, r, make([]byte, bufferSize))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = validateParquetFile(partPath)
+	}
+	if err == nil {
+		err = os.Rename(partPath, fullPath)
+	}
+	if err != nil {
+		_ = os.Remove(partPath)
+		return 0, err
+	}
+	return written, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateBundlePathTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl  string
+		valid bool
+	}{
+		{"{exchange}/{type}/{yyyy}/{mm}/{dd}/{exchange}_{file_part}_{date}.tar.gz", true},
+		{"bundles/{date}/{exchange}.tgz", true},
+		{"{exchange}/{yyyy}{mm}{dd}.tar.gz", true},
+		{"{exchange}/{yyyy}/{mm}.tar.gz", false},
+		{"{type}/{date}.tar.gz", false},
+		{"{exchange}/{pair}/{date}.tar.gz", false},
+		{"{exchange}/{date}.zip", false},
+		{"{exchange/{date}.tar.gz", false},
+	}
+	for _, tt := range tests {
+		err := validateBundlePathTemplate(tt.tmpl)
+		if tt.valid && err != nil {
+			t.Errorf("validateBundlePathTemplate(%q) = %v, want nil", tt.tmpl, err)
+		}
+		if !tt.valid && !errors.Is(err, errInvalidBundlePath) {
+			t.Errorf("validateBundlePathTemplate(%q) = %v, want %v", tt.tmpl, err, errInvalidBundlePath)
+		}
+	}
+}
+
+func TestBundleRelPath(t *testing.T) {
+	saved := bundlePathTemplate
+	bundlePathTemplate = "{exchange}/{type}/{yyyy}/{mm}/{dd}/{exchange}_{file_part}_{date}.tar.gz"
+	t.Cleanup(func() { bundlePathTemplate = saved })
+
+	got := bundleRelPath("binance", "trade", time.Date(2025, 11, 2, 0, 0, 0, 0, time.UTC))
+
+	if want := "binance/trade/2025/11/02/binance_trades_2025-11-02.tar.gz"; got != want {
+		t.Errorf("bundleRelPath() = %q, want %q", got, want)
+	}
+}
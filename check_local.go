@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+const defaultOutputDir = "downloads"
+
+var parquetMagic = []byte("PAR1")
+
+var (
+	errEmptyFile = errors.New("empty file")
+	errTooSmall  = errors.New("file too small to be parquet")
+	errBadHeader = errors.New("missing PAR1 header magic")
+	errBadFooter = errors.New("missing PAR1 footer magic")
+)
+
+func newCheckLocalCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check-local",
+		Short: "Validate local parquet files without network access",
+		Long: `Walks the output directory and checks that every .parquet file is
+structurally valid (non-zero size, PAR1 magic at both ends).`,
+		Run: runCheckLocal,
+	}
+	return cmd
+}
+
+func runCheckLocal(cmd *cobra.Command, args []string) {
+	if err := loadUserConfig(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	pterm.DefaultSection.Println("Checking Local Files")
+	pterm.Info.Printf("Directory: %s\n", outputDir)
+	pterm.Println()
+
+	tableData := [][]string{{"Status", "File", "Details"}}
+	var okCount, corruptCount int
+
+	err := filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".parquet") {
+			return nil
+		}
+
+		if err := validateParquetFile(path); err != nil {
+			corruptCount++
+			tableData = append(tableData, []string{pterm.Red("CORRUPT"), path, err.Error()})
+			return nil
+		}
+		okCount++
+		tableData = append(tableData, []string{pterm.Green("OK"), path, ""})
+		return nil
+	})
+	if err != nil {
+		pterm.Error.Printf("Failed to walk %s: %v\n", outputDir, err)
+		os.Exit(1)
+	}
+
+	if okCount+corruptCount == 0 {
+		pterm.Warning.Println("No parquet files found.")
+		return
+	}
+
+	renderTable(pterm.DefaultTable.
+		WithHasHeader().
+		WithBoxed().
+		WithData(tableData))
+
+	pterm.Println()
+	pterm.Info.Printf("OK: %d, Corrupt: %d\n", okCount, corruptCount)
+	if corruptCount > 0 {
+		os.Exit(1)
+	}
+}
+
+// validateParquetFile performs a cheap structural check: a parquet file starts
+// and ends with the 4-byte "PAR1" magic.
+func validateParquetFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size == 0 {
+		return errEmptyFile
+	}
+	magicLen := int64(len(parquetMagic))
+	if size < 2*magicLen {
+		return errTooSmall
+	}
+
+	buf := make([]byte, magicLen)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf, parquetMagic) {
+		return errBadHeader
+	}
+
+	if _, err := f.ReadAt(buf, size-magicLen); err != nil {
+		return fmt.Errorf("read footer: %w", err)
+	}
+	if !bytes.Equal(buf, parquetMagic) {
+		return errBadFooter
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// checkpointFile lives in the output directory and records every job that
+// completed, one JSON object per line, so an interrupted batch can be resumed
+// with --resume. Downloads in progress periodically record how many bytes of
+// their .part file are safely on disk, so they can be continued from there.
+const checkpointFile = ".terminal-cli-checkpoint.jsonl"
+
+// checkpointInterval is how often a download in progress records its offset.
+const checkpointInterval = 5 * time.Second
+
+type checkpointEntry struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset,omitempty"` // Set while the download is in progress
+}
+
+// CheckpointState is what a previous run recorded in its checkpoint.
+type CheckpointState struct {
+	Completed map[string]bool
+	Offsets   map[string]int64 // Last recorded offset of unfinished downloads
+}
+
+// Checkpoint appends completed jobs to the checkpoint file. A nil *Checkpoint
+// is valid and records nothing.
+type Checkpoint struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func checkpointPath() string {
+	return filepath.Join(outputDir, checkpointFile)
+}
+
+func openCheckpoint(path string) (*Checkpoint, error) {
+	if err := mkdirOutput(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (c *Checkpoint) Record(path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.enc.Encode(checkpointEntry{Path: path})
+}
+
+// RecordOffset notes that the first offset bytes of the download to path are
+// on disk.
+func (c *Checkpoint) RecordOffset(path string, offset int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.enc.Encode(checkpointEntry{Path: path, Offset: offset})
+}
+
+func (c *Checkpoint) Close() {
+	if c == nil {
+		return
+	}
+	_ = c.file.Close()
+}
+
+// loadCheckpoint returns the local paths recorded as completed and the
+// offsets reached by unfinished downloads. A missing checkpoint yields an
+// empty state.
+func loadCheckpoint(path string) (CheckpointState, error) {
+	state := CheckpointState{Completed: make(map[string]bool), Offsets: make(map[string]int64)}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry checkpointEntry
+		// A crash can leave a truncated last line; ignore it.
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Offset > 0 {
+			state.Offsets[entry.Path] = entry.Offset
+		} else {
+			state.Completed[entry.Path] = true
+		}
+	}
+	return state, scanner.Err()
+}
+
+func removeCheckpoint() {
+	_ = os.Remove(checkpointPath())
+}
+
+// offsetRecorder wraps the file a download is written to and, every
+// checkpointInterval, syncs it and records the offset reached in the
+// checkpoint.
+type offsetRecorder struct {
+	file     *os.File
+	path     string // Final path of the download
+	offset   int64
+	lastSync time.Time
+}
+
+func (w *offsetRecorder) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.offset += int64(n)
+	if err == nil && runCheckpoint != nil && time.Since(w.lastSync) >= checkpointInterval {
+		if err := w.file.Sync(); err == nil {
+			runCheckpoint.RecordOffset(w.path, w.offset)
+		}
+		w.lastSync = time.Now()
+	}
+	return n, err
+}
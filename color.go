@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pterm/pterm"
+)
+
+// Values accepted by --color.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+var colorMode string
+
+var errUnknownColorMode = errors.New("unknown color mode")
+
+// applyColorMode turns colored output on or off. In auto mode colors are used
+// unless the NO_COLOR environment variable is set.
+func applyColorMode(mode string) error {
+	switch mode {
+	case colorAuto:
+		if os.Getenv("NO_COLOR") != "" {
+			pterm.DisableColor()
+		}
+	case colorAlways:
+		pterm.EnableColor()
+	case colorNever:
+		pterm.DisableColor()
+	default:
+		return fmt.Errorf("%w: %s (supported: %s, %s, %s)", errUnknownColorMode, mode, colorAuto, colorAlways, colorNever)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	compareA    string
+	compareB    string
+	compareHash bool
+)
+
+func newCompareCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compare",
+		Short: "Compare two local dataset directories",
+		Long: `Walks two output directories and reports files present in only one of
+them and common files whose sizes differ. With --hash, common files of equal
+size are also compared by SHA-256. Unfinished .part files are ignored.`,
+		Run: runCompare,
+	}
+	cmd.Flags().StringVar(&compareA, "a", "", "First dataset directory")
+	cmd.Flags().StringVar(&compareB, "b", "", "Second dataset directory")
+	cmd.Flags().BoolVar(&compareHash, "hash", false, "Also compare the SHA-256 of common files with equal sizes")
+	_ = cmd.MarkFlagRequired("a")
+	_ = cmd.MarkFlagRequired("b")
+	return cmd
+}
+
+func runCompare(cmd *cobra.Command, args []string) {
+	pterm.DefaultSection.Println("Comparing Datasets")
+	pterm.Info.Printf("A: %s\n", compareA)
+	pterm.Info.Printf("B: %s\n", compareB)
+	pterm.Println()
+
+	filesA, err := datasetFiles(compareA)
+	if err != nil {
+		pterm.Error.Printf("Failed to walk %s: %v\n", compareA, err)
+		os.Exit(1)
+	}
+	filesB, err := datasetFiles(compareB)
+	if err != nil {
+		pterm.Error.Printf("Failed to walk %s: %v\n", compareB, err)
+		os.Exit(1)
+	}
+
+	paths := make([]string, 0, len(filesA)+len(filesB))
+	for rel := range filesA {
+		paths = append(paths, rel)
+	}
+	for rel := range filesB {
+		if _, ok := filesA[rel]; !ok {
+			paths = append(paths, rel)
+		}
+	}
+	slices.Sort(paths)
+
+	tableData := [][]string{{"Status", "File", "Details"}}
+	var onlyA, onlyB, mismatched, identical int
+	for _, rel := range paths {
+		sizeA, inA := filesA[rel]
+		sizeB, inB := filesB[rel]
+		switch {
+		case !inB:
+			onlyA++
+			tableData = append(tableData, []string{pterm.Yellow("ONLY IN A"), rel, formatSize(sizeA)})
+		case !inA:
+			onlyB++
+			tableData = append(tableData, []string{pterm.Yellow("ONLY IN B"), rel, formatSize(sizeB)})
+		case sizeA != sizeB:
+			mismatched++
+			tableData = append(tableData, []string{pterm.Red("SIZE"), rel,
+				fmt.Sprintf("%d vs %d bytes", sizeA, sizeB)})
+		case compareHash:
+			detail, err := compareHashes(filepath.Join(compareA, rel), filepath.Join(compareB, rel))
+			if err != nil || detail != "" {
+				mismatched++
+				if err != nil {
+					detail = err.Error()
+				}
+				tableData = append(tableData, []string{pterm.Red("HASH"), rel, detail})
+				continue
+			}
+			identical++
+		default:
+			identical++
+		}
+	}
+
+	if len(tableData) > 1 {
+		renderTable(pterm.DefaultTable.
+			WithHasHeader().
+			WithBoxed().
+			WithData(tableData))
+		pterm.Println()
+	}
+
+	how := "size"
+	if compareHash {
+		how = "size and SHA-256"
+	}
+	pterm.Info.Printf("Identical (by %s): %d, Only in A: %d, Only in B: %d, Mismatched: %d\n",
+		how, identical, onlyA, onlyB, mismatched)
+	if onlyA+onlyB+mismatched > 0 {
+		os.Exit(1)
+	}
+	pterm.Success.Println("The datasets match.")
+}
+
+// datasetFiles returns the size of every regular file under dir, keyed by
+// its slash-separated path relative to dir.
+func datasetFiles(dir string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(d.Name(), partSuffix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info.Size()
+		return nil
+	})
+	return files, err
+}
+
+// compareHashes returns a description of the difference between the two
+// files' SHA-256 hashes, or "" if they are equal.
+func compareHashes(pathA, pathB string) (string, error) {
+	hashA, err := sha256File(pathA)
+	if err != nil {
+		return "", err
+	}
+	hashB, err := sha256File(pathB)
+	if err != nil {
+		return "", err
+	}
+	if hashA == hashB {
+		return "", nil
+	}
+	return fmt.Sprintf("%s vs %s", hashA[:12], hashB[:12]), nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
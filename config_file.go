@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// defaultConfigFile is read from the working directory when --config is not
+// given.
+const defaultConfigFile = "terminal-cli.json"
+
+// Profile bundles the settings for one environment (e.g. dev, staging, prod).
+type Profile struct {
+	APIURL    string `json:"api-url"`
+	APIKey    string `json:"api-key"`
+	OutputDir string `json:"output-dir"`
+}
+
+// ExchangeEndpoint overrides the API key and/or API URL used to fetch the
+// links of one exchange's files.
+type ExchangeEndpoint struct {
+	APIURL string `json:"api-url"`
+	APIKey string `json:"api-key"`
+}
+
+// ConfigFile is the user configuration read from --config.
+type ConfigFile struct {
+	Profiles  map[string]Profile          `json:"profiles"`
+	Exchanges map[string]ExchangeEndpoint `json:"exchanges"`
+}
+
+// exchangeEndpoints are the per-exchange overrides of the config file.
+var exchangeEndpoints map[string]ExchangeEndpoint
+
+var errUnknownProfile = errors.New("unknown profile")
+
+// loadConfigFile reads the config file at path, expanding environment
+// variables in its values. A missing file yields an empty config.
+func loadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ConfigFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg ConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := expandConfigEnv(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// loadUserConfig reads the --config file, applies --profile if one is given
+// and keeps the per-exchange endpoints.
+func loadUserConfig(cmd *cobra.Command) error {
+	cfg, err := loadConfigFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if profile != "" {
+		if err := applyProfile(cmd, cfg, profile); err != nil {
+			return err
+		}
+	}
+	exchangeEndpoints = cfg.Exchanges
+	if len(apiURLMirrors) > 0 {
+		if runMirrors, err = newMirrors(apiURL, apiURLMirrors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkEndpoint returns the API URL and key that the link of relPath is
+// requested with: those configured for its exchange, falling back to
+// --api-url and key.
+func linkEndpoint(relPath, key string) (string, string) {
+	endpoint := exchangeEndpoints[pathExchange(relPath)]
+	return cmp.Or(endpoint.APIURL, apiURL), cmp.Or(endpoint.APIKey, key)
+}
+
+// applyProfile fills --api-url, --api-key and --output-dir from the named
+// profile. Flags given on the command line take precedence.
+func applyProfile(cmd *cobra.Command, cfg *ConfigFile, name string) error {
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(cfg.Profiles))
+		for n := range cfg.Profiles {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		if len(names) == 0 {
+			return fmt.Errorf("%w %q: no profiles defined in %s", errUnknownProfile, name, configPath)
+		}
+		return fmt.Errorf("%w %q (available: %s)", errUnknownProfile, name, strings.Join(names, ", "))
+	}
+
+	set := func(flag string, dst *string, val string) {
+		if val != "" && !cmd.Flags().Changed(flag) {
+			*dst = val
+		}
+	}
+	set("api-url", &apiURL, profile.APIURL)
+	set("api-key", &apiKey, profile.APIKey)
+	set("output-dir", &outputDir, profile.OutputDir)
+	return nil
+}
+
+func newConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "config",
+		Short: "Print the resolved configuration and where each value came from",
+		Long: `Resolves --api-url, --api-key and --output-dir the same way a download
+does (flag, then --profile from the config file, then environment, then
+default) and prints each value with its source. The API key is masked.`,
+		Run: runConfig,
+	}
+}
+
+func runConfig(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfigFile(configPath)
+	if err != nil {
+		pterm.Error.Printf("Failed to read config file: %v\n", err)
+		os.Exit(1)
+	}
+
+	fileSource := "default"
+	if cmd.Flags().Changed("config") {
+		fileSource = "flag"
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		fileSource += " (not found)"
+	}
+
+	// The profile is applied as for a download; p tells which values it
+	// supplied.
+	var p Profile
+	if profile != "" {
+		if err := applyProfile(cmd, cfg, profile); err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		p = cfg.Profiles[profile]
+	}
+
+	source := func(flag, fromProfile string) string {
+		switch {
+		case cmd.Flags().Changed(flag):
+			return "flag"
+		case fromProfile != "":
+			return fmt.Sprintf("file (profile %s)", profile)
+		}
+		return "default"
+	}
+
+	keySource := source("api-key", p.APIKey)
+	if src, err := loadAPIKeySource(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	} else if src != "" {
+		keySource = src
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("API_KEY")
+		keySource = "env (API_KEY)"
+		if apiKey == "" {
+			keySource = "not set"
+		}
+	}
+
+	tableData := pterm.TableData{
+		{"Setting", "Value", "Source"},
+		{"config", configPath, fileSource},
+		{"profile", profile, source("profile", "")},
+		{"api-url", apiURL, source("api-url", p.APIURL)},
+		{"api-key", maskSecret(apiKey), keySource},
+		{"output-dir", outputDir, source("output-dir", p.OutputDir)},
+		{"table-style", tableStyle, source("table-style", "")},
+		{"color", colorMode, source("color", "")},
+	}
+	for _, ex := range slices.Sorted(maps.Keys(cfg.Exchanges)) {
+		endpoint := cfg.Exchanges[ex]
+		if endpoint.APIURL != "" {
+			tableData = append(tableData, []string{"api-url (" + ex + ")", endpoint.APIURL, "file (exchanges)"})
+		}
+		if endpoint.APIKey != "" {
+			tableData = append(tableData, []string{"api-key (" + ex + ")", maskSecret(endpoint.APIKey), "file (exchanges)"})
+		}
+	}
+	renderTable(pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(tableData))
+}
+
+// maskSecret hides all but the last four characters of a secret.
+func maskSecret(secret string) string {
+	if len(secret) <= 4 {
+		return strings.Repeat("*", len(secret))
+	}
+	return strings.Repeat("*", len(secret)-4) + secret[len(secret)-4:]
+}
+
+var (
+	errAPIKeySources = errors.New("use only one of --api-key, --api-key-file and --api-key-cmd")
+	errEmptyAPIKey   = errors.New("no API key found")
+)
+
+// loadAPIKeySource sets the API key from --api-key-file or --api-key-cmd,
+// which take precedence over profiles and the environment. It returns a
+// description of the source used, or "" if neither flag was given. The key
+// itself never appears in errors or output.
+func loadAPIKeySource(cmd *cobra.Command) (string, error) {
+	given := 0
+	for _, flag := range []string{"api-key", "api-key-file", "api-key-cmd"} {
+		if cmd.Flags().Changed(flag) {
+			given++
+		}
+	}
+	if given > 1 {
+		return "", errAPIKeySources
+	}
+
+	var key, source string
+	var err error
+	switch {
+	case apiKeyFile != "":
+		key, err = readAPIKeyFile(apiKeyFile)
+		source = "file (--api-key-file)"
+	case apiKeyCmd != "":
+		key, err = runAPIKeyCmd(apiKeyCmd)
+		source = "command (--api-key-cmd)"
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	apiKey = key
+	if apiKeyCmd != "" {
+		runReauth = newReauth(apiKeyCmd, key)
+	}
+	return source, nil
+}
+
+// readAPIKeyFile reads the key from the first line of path, warning if other
+// users may read the file.
+func readAPIKeyFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("reading --api-key-file: %w", err)
+	}
+	// Windows doesn't use permission bits.
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		pterm.Warning.Printf("%s is accessible by other users (mode %04o); restrict it with chmod 600\n", path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading --api-key-file: %w", err)
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	key := strings.TrimSpace(line)
+	if key == "" {
+		return "", fmt.Errorf("%w in %s", errEmptyAPIKey, path)
+	}
+	return key, nil
+}
+
+// runAPIKeyCmd runs command through the shell (e.g. "pass show redstone") and
+// returns the first line it prints. Its stderr goes to the terminal, so it can
+// prompt for a passphrase.
+func runAPIKeyCmd(command string) (string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	c := exec.Command(shell, flag, command)
+	c.Stdin = os.Stdin
+	c.Stderr = os.Stderr
+	var out bytes.Buffer
+	c.Stdout = &out
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("running --api-key-cmd: %w", err)
+	}
+	line, _, _ := strings.Cut(out.String(), "\n")
+	key := strings.TrimSpace(line)
+	if key == "" {
+		return "", fmt.Errorf("%w: --api-key-cmd printed nothing", errEmptyAPIKey)
+	}
+	return key, nil
+}
+
+// minAPIKeyLength is the shortest key the API gateway issues.
+const minAPIKeyLength = 20
+
+var (
+	errNoAPIKey        = errors.New("no API key set (use --api-key, --api-key-file, --api-key-cmd, the API_KEY environment variable or a profile)")
+	errMalformedAPIKey = errors.New("API key looks malformed")
+)
+
+// checkAPIKeys runs checkAPIKey on every per-exchange key, and on the global
+// key unless each requested exchange has a key of its own. With --filter the
+// exchanges aren't known upfront, so the global key is always checked.
+func checkAPIKeys() error {
+	for _, ex := range slices.Sorted(maps.Keys(exchangeEndpoints)) {
+		if key := exchangeEndpoints[ex].APIKey; key != "" {
+			if err := checkAPIKey(key); err != nil {
+				return fmt.Errorf("exchange %s: %w", ex, err)
+			}
+		}
+	}
+	if runFilter == nil && len(exchanges) > 0 && !slices.ContainsFunc(exchanges, func(ex string) bool {
+		return exchangeEndpoints[strings.TrimSpace(ex)].APIKey == ""
+	}) {
+		return nil
+	}
+	return checkAPIKey(apiKey)
+}
+
+// checkAPIKey catches the most common setup mistakes before a batch starts:
+// a missing key, or one mangled by copy-pasting (surrounding quotes or
+// whitespace, or truncated).
+func checkAPIKey(key string) error {
+	if key == "" {
+		return errNoAPIKey
+	}
+	if strings.ContainsAny(key, " \t\r\n\"'") {
+		return fmt.Errorf("%w: it contains whitespace or quotes", errMalformedAPIKey)
+	}
+	if len(key) < minAPIKeyLength {
+		return fmt.Errorf("%w: expected at least %d characters, got %d", errMalformedAPIKey, minAPIKeyLength, len(key))
+	}
+	return nil
+}
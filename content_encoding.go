@@ -0,0 +1,28 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var errCompressedRange = errors.New("server sent a gzip-encoded partial response, which can't be resumed")
+
+// isGzipEncoded reports whether a response body is gzip-compressed on the
+// wire. Some CDNs compress parquet files for transfer, and the file on disk
+// must be the decompressed one.
+func isGzipEncoded(header http.Header) bool {
+	encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding")))
+	return encoding == "gzip" || encoding == "x-gzip"
+}
+
+// decodeBody returns a reader of the decompressed body if header says r is
+// gzip-encoded, and r itself otherwise.
+func decodeBody(r io.Reader, header http.Header) (io.Reader, error) {
+	if !isGzipEncoded(header) {
+		return r, nil
+	}
+	return gzip.NewReader(r)
+}
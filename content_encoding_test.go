@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownloadStreamDecompressesGzipBody(t *testing.T) {
+	compressed := gzipBytes(t, testFileContent)
+	var acceptEncoding string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", fmt.Sprint(len(compressed)))
+		_, _ = w.Write(compressed)
+	}))
+	defer srv.Close()
+	fullPath := filepath.Join(t.TempDir(), "file.parquet")
+
+	total, _, err := downloadStream(srv.URL, fullPath, int64(len(testFileContent)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if acceptEncoding != "gzip" {
+		t.Errorf("Accept-Encoding = %q, want gzip", acceptEncoding)
+	}
+	if total != int64(len(testFileContent)) {
+		t.Errorf("total = %d, want the decompressed size %d", total, len(testFileContent))
+	}
+	assertDownloaded(t, fullPath)
+}
+
+func TestDownloadStreamRejectsGzipRange(t *testing.T) {
+	withResume(t)
+	const offset = 10000
+	compressed := gzipBytes(t, testFileContent[offset:])
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(testFileContent)-1, len(testFileContent)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(compressed)
+	}))
+	defer srv.Close()
+	fullPath := filepath.Join(t.TempDir(), "file.parquet")
+	writePart(t, fullPath, offset)
+
+	_, _, err := downloadStream(srv.URL, fullPath, int64(len(testFileContent)), nil)
+
+	if !errors.Is(err, errCompressedRange) {
+		t.Errorf("err = %v, want %v", err, errCompressedRange)
+	}
+	if _, err := os.Stat(fullPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a file was written for the compressed range: %v", err)
+	}
+}
+
+func TestIsGzipEncoded(t *testing.T) {
+	tests := []struct {
+		encoding string
+		want     bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{" x-gzip ", true},
+		{"br", false},
+		{"identity", false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.encoding != "" {
+			header.Set("Content-Encoding", tt.encoding)
+		}
+		if got := isGzipEncoded(header); got != tt.want {
+			t.Errorf("isGzipEncoded(%q) = %v, want %v", tt.encoding, got, tt.want)
+		}
+	}
+}
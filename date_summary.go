@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/pterm/pterm"
+)
+
+// outcomeCounts is the outcome of a group of jobs. Missing counts files the
+// server doesn't have (404), whether or not --touch-missing recorded them;
+// Failed counts the other failures.
+type outcomeCounts struct {
+	Files      int `json:"files"`
+	Succeeded  int `json:"succeeded"` // Downloaded or already present
+	Failed     int `json:"failed"`
+	Missing    int `json:"missing"`
+	NotStarted int `json:"not_started"`
+}
+
+func (c *outcomeCounts) add(result JobResult) {
+	c.Files++
+	switch {
+	case result.Status == StatusSuccess || result.Status == StatusSkipped:
+		c.Succeeded++
+	case result.Status == StatusMissing || errors.Is(result.Err, errFileNotFound):
+		c.Missing++
+	case result.Status == StatusNotStarted:
+		c.NotStarted++
+	default:
+		c.Failed++
+	}
+}
+
+// dateCounts is the outcome of one date's jobs in the --summarize-by-date
+// breakdown.
+type dateCounts struct {
+	Date string `json:"date"`
+	outcomeCounts
+}
+
+// countByDate aggregates the results by job date, in chronological order.
+func countByDate(stats RunStats) []dateCounts {
+	byDate := make(map[string]*dateCounts)
+	for _, result := range stats.Results {
+		date := result.Date.Format(serverDateFormat)
+		c := byDate[date]
+		if c == nil {
+			c = &dateCounts{Date: date}
+			byDate[date] = c
+		}
+		c.add(result)
+	}
+
+	counts := make([]dateCounts, 0, len(byDate))
+	for _, c := range byDate {
+		counts = append(counts, *c)
+	}
+	// Dates are formatted as YYYY-MM-DD, so they sort chronologically.
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Date < counts[j].Date })
+	return counts
+}
+
+// printDateSummary renders the --summarize-by-date table. A date on which
+// no file succeeded is highlighted, since that points at a whole-day outage
+// rather than scattered failures.
+func printDateSummary(stats RunStats) {
+	counts := countByDate(stats)
+	if len(counts) == 0 {
+		return
+	}
+	tableData := pterm.TableData{{"Date", "Files", "Succeeded", "Failed", "Missing", "Not started"}}
+	var outages int
+	for _, c := range counts {
+		date := c.Date
+		if c.Succeeded == 0 && c.Failed+c.Missing > 0 {
+			outages++
+			date = pterm.Red(date)
+		}
+		tableData = append(tableData, []string{date, fmt.Sprint(c.Files), fmt.Sprint(c.Succeeded),
+			fmt.Sprint(c.Failed), fmt.Sprint(c.Missing), fmt.Sprint(c.NotStarted)})
+	}
+	pterm.Println()
+	renderTable(pterm.DefaultTable.WithHasHeader().WithData(tableData))
+	if outages > 0 {
+		pterm.Warning.Printf("Dates without a single successful file: %d\n", outages)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain gives the flag globals the tests rely on their default values,
+// which are otherwise only set when the command line is parsed.
+func TestMain(m *testing.M) {
+	bufferSize = defaultBufferSize
+	os.Exit(m.Run())
+}
+
+// testFileContent is the body served by the download tests.
+var testFileContent = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+// withResume turns on --resume for the duration of a test.
+func withResume(t *testing.T) {
+	t.Helper()
+	saved, savedState := resume, resumeState
+	resume, resumeState = true, CheckpointState{}
+	t.Cleanup(func() { resume, resumeState = saved, savedState })
+}
+
+// writePart leaves the first n bytes of testFileContent behind as the .part
+// file of an interrupted download of fullPath.
+func writePart(t *testing.T, fullPath string, n int) {
+	t.Helper()
+	if err := os.WriteFile(fullPath+partSuffix, testFileContent[:n], 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertDownloaded(t *testing.T, fullPath string) {
+	t.Helper()
+	got, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, testFileContent) {
+		t.Errorf("downloaded %d bytes that differ from the %d served", len(got), len(testFileContent))
+	}
+	if _, err := os.Stat(fullPath + partSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the .part file is left behind: %v", err)
+	}
+}
+
+func TestDownloadStreamResumesWithPartialContent(t *testing.T) {
+	withResume(t)
+	const offset = 10000
+	var gotRange string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(testFileContent)-1, len(testFileContent)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(testFileContent[offset:])
+	}))
+	defer srv.Close()
+	fullPath := filepath.Join(t.TempDir(), "file.parquet")
+	writePart(t, fullPath, offset)
+
+	total, _, err := downloadStream(srv.URL, fullPath, int64(len(testFileContent)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := fmt.Sprintf("bytes=%d-", offset); gotRange != want {
+		t.Errorf("Range header = %q, want %q", gotRange, want)
+	}
+	if total != int64(len(testFileContent)) {
+		t.Errorf("total = %d, want %d", total, len(testFileContent))
+	}
+	assertDownloaded(t, fullPath)
+}
+
+func TestDownloadStreamRestartsWhenRangeIgnored(t *testing.T) {
+	withResume(t)
+	var gotRange string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		_, _ = w.Write(testFileContent)
+	}))
+	defer srv.Close()
+	fullPath := filepath.Join(t.TempDir(), "file.parquet")
+	writePart(t, fullPath, 10000)
+
+	total, _, err := downloadStream(srv.URL, fullPath, int64(len(testFileContent)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotRange == "" {
+		t.Error("no Range header sent for the partial file")
+	}
+	if total != int64(len(testFileContent)) {
+		t.Errorf("total = %d, want %d", total, len(testFileContent))
+	}
+	assertDownloaded(t, fullPath)
+}
+
+func TestDownloadStreamRejectsUnexpectedPartialContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-999/%d", len(testFileContent)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(testFileContent[:1000])
+	}))
+	defer srv.Close()
+	fullPath := filepath.Join(t.TempDir(), "file.parquet")
+
+	_, _, err := downloadStream(srv.URL, fullPath, 0, nil)
+
+	if !errors.Is(err, errUnexpectedPartialContent) {
+		t.Errorf("err = %v, want %v", err, errUnexpectedPartialContent)
+	}
+	if _, err := os.Stat(fullPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a file was written for the partial response: %v", err)
+	}
+}
+
+func TestDownloadStreamDetectsIncompleteDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testFileContent[:1000])
+	}))
+	defer srv.Close()
+	fullPath := filepath.Join(t.TempDir(), "file.parquet")
+
+	_, _, err := downloadStream(srv.URL, fullPath, int64(len(testFileContent)), nil)
+
+	if !errors.Is(err, errSizeMismatch) {
+		t.Errorf("err = %v, want %v", err, errSizeMismatch)
+	}
+	for _, path := range []string{fullPath, fullPath + partSuffix} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s is left behind: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pterm/pterm"
+)
+
+// estimate is what --estimate learned about one job.
+type estimate struct {
+	exists bool  // Already downloaded; would be skipped
+	size   int64 // Reported by the API (0 if unknown)
+	err    error
+}
+
+// runDryRun prints the plan for jobs without downloading anything. With
+// --estimate it also fetches the download link of every file not yet present
+// locally, to report exact sizes and which files the server doesn't have.
+func runDryRun(jobs []Job) {
+	var estimates []estimate
+	if estimateSizes {
+		estimates = estimateJobs(jobs)
+	}
+
+	pterm.DefaultSection.Println("Dry Run")
+	header := []string{"#", "Exchange", "Pair", "Date", "Local path"}
+	if estimateSizes {
+		header = append(header, "Status", "Size")
+	}
+	tableData := pterm.TableData{header}
+
+	var available, missing, failed, existing int
+	var totalSize int64
+	for i, job := range jobs {
+		row := []string{fmt.Sprint(job.Index), job.Exchange, job.Pair, job.Date.Format(serverDateFormat), job.FullPath}
+		if estimateSizes {
+			e := estimates[i]
+			switch {
+			case e.exists:
+				existing++
+				row = append(row, pterm.Yellow("Exists locally"), "")
+			case errors.Is(e.err, errFileNotFound):
+				missing++
+				row = append(row, pterm.Magenta("Missing (404)"), "")
+			case e.err != nil:
+				failed++
+				row = append(row, pterm.Red("Error: "+e.err.Error()), "")
+			default:
+				available++
+				totalSize += e.size
+				row = append(row, pterm.Green("Available"), formatSize(e.size))
+			}
+		}
+		tableData = append(tableData, row)
+	}
+	renderTable(pterm.DefaultTable.WithHasHeader().WithData(tableData))
+
+	pterm.Println()
+	if savePlanPath != "" {
+		if err := savePlan(newPlan(jobs, estimates), savePlanPath); err != nil {
+			pterm.Error.Printf("Failed to save plan: %v\n", err)
+			os.Exit(1)
+		}
+		pterm.Success.Printf("Saved the plan of %d files to %s; run it with --execute-plan %s\n", len(jobs), savePlanPath, savePlanPath)
+	}
+	if !estimateSizes {
+		pterm.Info.Printf("Dry run: %d files would be requested. Add --estimate to fetch their sizes.\n", len(jobs))
+		return
+	}
+	pterm.Info.Printf("Available: %d files, %s total\n", available, formatSize(totalSize))
+	if existing > 0 {
+		pterm.Info.Printf("Already downloaded: %d files\n", existing)
+	}
+	if missing > 0 {
+		pterm.Warning.Printf("Missing on server: %d files\n", missing)
+	}
+	if failed > 0 {
+		pterm.Warning.Printf("Could not be checked: %d files\n", failed)
+	}
+}
+
+// estimateJobs fetches the download link of every job not present locally,
+// using --parallel concurrent requests. No file data is transferred.
+func estimateJobs(jobs []Job) []estimate {
+	estimates := make([]estimate, len(jobs))
+	spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Fetching sizes of %d files...", len(jobs)))
+
+	forEachParallel(len(jobs), parallelism, func(idx int) {
+		if fileExists(jobs[idx].FullPath) {
+			estimates[idx] = estimate{exists: true}
+			return
+		}
+		_, size, err := fetchDownloadLink(apiKey, jobs[idx].RelPath)
+		estimates[idx] = estimate{size: size, err: err}
+	})
+
+	_ = spinner.Stop()
+	return estimates
+}
+
+// formatSize renders a byte count in MB, or "unknown" for 0.
+func formatSize(size int64) string {
+	if size <= 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.2f MB", float64(size)/1024/1024)
+}
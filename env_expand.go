@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var errUnsetVariable = errors.New("environment variable is not set")
+
+// expandEnv replaces $NAME and ${NAME} in s with the value of the environment
+// variable NAME, and $$ with a literal $. A $ that starts neither is kept as
+// it is, so regular expressions such as ^btc_.*$ need no escaping. A variable
+// that isn't set is an error rather than an empty string, which would turn
+// e.g. ${DATA_ROOT}/redstone into /redstone.
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		var name string
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+			continue
+		case next == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 || !isEnvName(s[i+2:i+2+end]) {
+				return "", fmt.Errorf("malformed ${...} in %q (write $$ for a literal $)", s)
+			}
+			name = s[i+2 : i+2+end]
+			i += 2 + end
+		case isEnvNameStart(next):
+			end := i + 2
+			for end < len(s) && isEnvNameChar(s[end]) {
+				end++
+			}
+			name = s[i+1 : end]
+			i = end - 1
+		default:
+			b.WriteByte('$')
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%w: %s (write $$ for a literal $)", errUnsetVariable, name)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+func isEnvName(name string) bool {
+	if name == "" || !isEnvNameStart(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isEnvNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isEnvNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isEnvNameChar(c byte) bool {
+	return isEnvNameStart(c) || ('0' <= c && c <= '9')
+}
+
+// noExpandFlags are the text flags whose values are passed on verbatim: API
+// keys and key commands, where the shell already expanded what it should and
+// a $ left over belongs to the key or the command, and filters, regular
+// expressions and templates, where $ has a meaning of its own.
+var noExpandFlags = map[string]bool{
+	"api-key":            true,
+	"api-key-cmd":        true,
+	"filter":             true,
+	"pair-include-regex": true,
+	"pair-exclude-regex": true,
+	"search":             true,
+	"summary-template":   true,
+}
+
+// expandFlagEnv expands environment variables in the string, string list and
+// string array flags given on the command line, except noExpandFlags. Flags
+// of other types are parsed before they could be expanded, so they are left
+// alone.
+func expandFlagEnv(cmd *cobra.Command) error {
+	var firstErr error
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if firstErr != nil || noExpandFlags[f.Name] {
+			return
+		}
+		switch f.Value.Type() {
+		case "string":
+			expanded, err := expandEnv(f.Value.String())
+			if err == nil {
+				err = f.Value.Set(expanded)
+			}
+			if err != nil {
+				firstErr = fmt.Errorf("--%s: %w", f.Name, err)
+			}
+		case "stringSlice", "stringArray":
+			slice, ok := f.Value.(pflag.SliceValue)
+			if !ok {
+				return
+			}
+			values := slice.GetSlice()
+			for i, value := range values {
+				expanded, err := expandEnv(value)
+				if err != nil {
+					firstErr = fmt.Errorf("--%s: %w", f.Name, err)
+					return
+				}
+				values[i] = expanded
+			}
+			if err := slice.Replace(values); err != nil {
+				firstErr = fmt.Errorf("--%s: %w", f.Name, err)
+			}
+		}
+	})
+	return firstErr
+}
+
+// expandConfigEnv expands environment variables in the values of the config
+// file's profiles and exchanges.
+func expandConfigEnv(cfg *ConfigFile) error {
+	expand := func(where string, dst *string) error {
+		expanded, err := expandEnv(*dst)
+		if err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+		*dst = expanded
+		return nil
+	}
+	for name, p := range cfg.Profiles {
+		for key, dst := range map[string]*string{"api-url": &p.APIURL, "api-key": &p.APIKey, "output-dir": &p.OutputDir} {
+			if err := expand(fmt.Sprintf("profiles.%s.%s", name, key), dst); err != nil {
+				return err
+			}
+		}
+		cfg.Profiles[name] = p
+	}
+	for name, e := range cfg.Exchanges {
+		for key, dst := range map[string]*string{"api-url": &e.APIURL, "api-key": &e.APIKey} {
+			if err := expand(fmt.Sprintf("exchanges.%s.%s", name, key), dst); err != nil {
+				return err
+			}
+		}
+		cfg.Exchanges[name] = e
+	}
+	return nil
+}
+
+// expandBundleEnv expands environment variables in the values of a bundle
+// file, before it is validated.
+func expandBundleEnv(b *Bundle) error {
+	for key, dst := range map[string]*string{"type": &b.Type, "mode": &b.Mode, "start_date": &b.StartDate, "end_date": &b.EndDate} {
+		expanded, err := expandEnv(*dst)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*dst = expanded
+	}
+	for key, list := range map[string][]string{"exchanges": b.Exchanges, "tokens": b.Tokens} {
+		for i, value := range list {
+			expanded, err := expandEnv(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			list[i] = expanded
+		}
+	}
+	return nil
+}
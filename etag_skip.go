@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unchangedByETag reports whether the local copy of job is still the file on
+// the server, for --skip-by-etag: the server's ETag must match the one
+// recorded in --manifest when the file was downloaded, and both the size the
+// server reports and the local file's size must match the recorded size. Any
+// doubt, such as a file the manifest doesn't know or a server that sends no
+// ETag, means the file is downloaded as usual.
+func unchangedByETag(job Job) bool {
+	entry, ok := runManifest.Entry(job.FullPath)
+	if !ok || entry.ETag == "" {
+		return false
+	}
+	info, err := os.Stat(job.FullPath)
+	if err != nil || info.Size() != entry.Size {
+		return false
+	}
+	etag, size, err := serverETag(job.RelPath)
+	if err != nil || etag == "" {
+		return false
+	}
+	return etag == entry.ETag && (size < 0 || size == entry.Size)
+}
+
+// serverETag returns the ETag and size of the file at relPath without
+// downloading it, or a size of -1 if the server doesn't say. Like
+// serverLastModified, it falls back to a one-byte GET if HEAD is refused.
+func serverETag(relPath string) (string, int64, error) {
+	link, _, err := cachedDownloadLink(relPath)
+	if err != nil {
+		return "", 0, err
+	}
+	header, err := probeHeaders(link, http.MethodHead)
+	if err == nil {
+		size, parseErr := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if parseErr != nil {
+			size = -1
+		}
+		return header.Get("ETag"), size, nil
+	}
+	header, err = probeHeaders(link, http.MethodGet)
+	if err != nil {
+		return "", 0, err
+	}
+	// A ranged response gives the full size after the slash of
+	// "bytes 0-0/3000000".
+	size := int64(-1)
+	if _, total, ok := strings.Cut(header.Get("Content-Range"), "/"); ok {
+		if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+			size = n
+		}
+	}
+	return header.Get("ETag"), size, nil
+}
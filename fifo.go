@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// isFIFO reports whether path is a named pipe. Downloads stream into a pipe
+// at their local path instead of writing a file, so a consumer can read the
+// data without it ever touching the disk.
+func isFIFO(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// downloadToFIFO streams the file at url into the named pipe at fullPath.
+// Opening the pipe blocks until a reader opens its other end. There is no
+// partial file, rename or resume, and the size isn't verified, since the
+// bytes are gone once the reader has them; a reader that goes away early
+// fails the download with a broken pipe.
+func downloadToFIFO(url, fullPath string, bar *pterm.ProgressbarPrinter) (total int64, header http.Header, err error) {
+	start := time.Now()
+	status := 0
+	defer func() {
+		runAudit.Download("download", url, "", start, status, total, err)
+	}()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(runHTTPDebug.Trace(req))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	acquireOpenFile()
+	defer releaseOpenFile()
+	pipe, err := os.OpenFile(fullPath, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	body, err := decodeBody(&ProgressReader{Reader: resp.Body, Bar: bar}, resp.Header)
+	if err != nil {
+		_ = pipe.Close()
+		return 0, nil, err
+	}
+	total, err = io.CopyBuffer(pipe, body, make([]byte, bufferSize))
+	if closeErr := pipe.Close(); err == nil {
+		err = closeErr
+	}
+	return total, resp.Header, err
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pterm/pterm"
+)
+
+var errInvalidFilter = errors.New("invalid filter")
+
+// runFilter is the parsed --filter of the current invocation, if any.
+var runFilter *Filter
+
+// Filter selects exchange/pair combinations with an SQL-like expression
+// (--filter), for example
+//
+//	exchange in (binance, bybit) and pair like '%_usdt' and not pair = 'luna_usdt'
+//
+// Fields are exchange and pair (or token); operators are =, !=, in, not in,
+// like and not like, combined with and, or, not and parentheses. In like
+// patterns, % matches any run of characters and _ any single one. Comparisons
+// ignore case.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// Match reports whether the filter selects pair on exchange.
+func (f *Filter) Match(exchange, pair string) bool {
+	return f.root.match(exchange, pair)
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+type filterNode interface {
+	match(exchange, pair string) bool
+}
+
+type andNode struct{ left, right filterNode }
+type orNode struct{ left, right filterNode }
+type notNode struct{ inner filterNode }
+
+func (n andNode) match(exchange, pair string) bool {
+	return n.left.match(exchange, pair) && n.right.match(exchange, pair)
+}
+
+func (n orNode) match(exchange, pair string) bool {
+	return n.left.match(exchange, pair) || n.right.match(exchange, pair)
+}
+
+func (n notNode) match(exchange, pair string) bool {
+	return !n.inner.match(exchange, pair)
+}
+
+// compareNode is a single field comparison. For like, pattern is set instead
+// of values.
+type compareNode struct {
+	field   string // "exchange" or "pair"
+	values  []string
+	pattern *regexp.Regexp
+}
+
+func (n compareNode) match(exchange, pair string) bool {
+	value := pair
+	if n.field == "exchange" {
+		value = exchange
+	}
+	if n.pattern != nil {
+		return n.pattern.MatchString(value)
+	}
+	return slices.ContainsFunc(n.values, func(v string) bool { return strings.EqualFold(v, value) })
+}
+
+// filterToken is a lexical token of a filter expression. Quoted strings are
+// kept apart from bare words so that a value such as 'and' is not taken for
+// a keyword.
+type filterToken struct {
+	text   string
+	quoted bool
+	pos    int // 1-based character position, for error messages
+}
+
+// parseFilter parses a --filter expression.
+func parseFilter(expr string) (*Filter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty expression", errInvalidFilter)
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == ',' || r == '=':
+			tokens = append(tokens, filterToken{text: string(r), pos: i + 1})
+			i++
+		case r == '!':
+			if i+1 >= len(runes) || runes[i+1] != '=' {
+				return nil, fmt.Errorf("%w: expected != at position %d", errInvalidFilter, i+1)
+			}
+			tokens = append(tokens, filterToken{text: "!=", pos: i + 1})
+			i += 2
+		case r == '\'' || r == '"':
+			end := slices.Index(runes[i+1:], r)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated string at position %d", errInvalidFilter, i+1)
+			}
+			tokens = append(tokens, filterToken{text: string(runes[i+1 : i+1+end]), quoted: true, pos: i + 1})
+			i += end + 2
+		case isFilterWordRune(r):
+			start := i
+			for i < len(runes) && isFilterWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{text: string(runes[start:i]), pos: start + 1})
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q at position %d", errInvalidFilter, r, i+1)
+		}
+	}
+	return tokens, nil
+}
+
+func isFilterWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' || r == '%'
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	where := "at the end"
+	if p.pos < len(p.tokens) {
+		where = fmt.Sprintf("at position %d", p.tokens[p.pos].pos)
+	}
+	return fmt.Errorf("%w: %s %s", errInvalidFilter, fmt.Sprintf(format, args...), where)
+}
+
+// keyword consumes the next token if it is the unquoted keyword word.
+func (p *filterParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.keyword("not") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	if p.keyword("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, p.errorf("expected )")
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses field op value, where op is =, !=, [not] in or
+// [not] like.
+func (p *filterParser) parseComparison() (filterNode, error) {
+	var field string
+	switch {
+	case p.keyword("exchange"):
+		field = "exchange"
+	case p.keyword("pair"), p.keyword("token"):
+		field = "pair"
+	default:
+		return nil, p.errorf("expected exchange or pair")
+	}
+
+	negate := false
+	var op string
+	switch {
+	case p.keyword("="):
+		op = "="
+	case p.keyword("!="):
+		op, negate = "=", true
+	case p.keyword("in"):
+		op = "in"
+	case p.keyword("like"):
+		op = "like"
+	case p.keyword("not"):
+		negate = true
+		switch {
+		case p.keyword("in"):
+			op = "in"
+		case p.keyword("like"):
+			op = "like"
+		default:
+			return nil, p.errorf("expected in or like after not")
+		}
+	default:
+		return nil, p.errorf("expected =, !=, in or like after %s", field)
+	}
+
+	node := compareNode{field: field}
+	switch op {
+	case "=":
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.values = []string{value}
+	case "like":
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.pattern = likePattern(value)
+	case "in":
+		values, err := p.valueList()
+		if err != nil {
+			return nil, err
+		}
+		node.values = values
+	}
+	if negate {
+		return notNode{node}, nil
+	}
+	return node, nil
+}
+
+func (p *filterParser) value() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", p.errorf("expected a value")
+	}
+	tok := p.tokens[p.pos]
+	if !tok.quoted && slices.Contains([]string{"(", ")", ",", "=", "!="}, tok.text) {
+		return "", p.errorf("expected a value")
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+func (p *filterParser) valueList() ([]string, error) {
+	if !p.keyword("(") {
+		return nil, p.errorf("expected ( after in")
+	}
+	var values []string
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if p.keyword(")") {
+			return values, nil
+		}
+		if !p.keyword(",") {
+			return nil, p.errorf("expected , or )")
+		}
+	}
+}
+
+// likePattern compiles an SQL like pattern into a case-insensitive regexp
+// matching the whole value.
+func likePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// reportFilter prints the exchanges and pairs the --filter selects between
+// start and end, and fails if it selects none.
+func reportFilter(start, end time.Time, configRules []ConfigRule) {
+	selected := make(map[string]map[string]bool)
+	for curr := start; !curr.After(end); curr = curr.AddDate(0, 0, 1) {
+		for ex, pairs := range getConfigForDate(configRules, curr) {
+			for _, pair := range pairs {
+				if !runFilter.Match(ex, pair) {
+					continue
+				}
+				if selected[ex] == nil {
+					selected[ex] = make(map[string]bool)
+				}
+				selected[ex][pair] = true
+			}
+		}
+	}
+	if len(selected) == 0 {
+		pterm.Error.Printf("Filter %q matches no files between %s and %s\n",
+			runFilter, start.Format("2006-01-02"), end.Format("2006-01-02"))
+		os.Exit(1)
+	}
+
+	count := 0
+	for _, pairs := range selected {
+		count += len(pairs)
+	}
+	pterm.Info.Printf("Filter %q matches %d pairs on %d exchanges:\n", runFilter, count, len(selected))
+	for _, ex := range slices.Sorted(maps.Keys(selected)) {
+		pterm.Info.Printf("  %s: %s\n", ex, strings.Join(slices.Sorted(maps.Keys(selected[ex])), ", "))
+	}
+}
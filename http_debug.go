@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// defaultLogFile receives diagnostic output such as --debug-http traces when
+// --log-file is not given.
+const defaultLogFile = "terminal-cli.log"
+
+// HTTPDebugLog writes connection timings of every request to the --log-file
+// and tallies how often pooled connections were reused. A nil *HTTPDebugLog
+// is valid and traces nothing.
+type HTTPDebugLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	requests int
+	reused   int
+}
+
+// runHTTPDebug is the --debug-http log of the current invocation.
+var runHTTPDebug *HTTPDebugLog
+
+func openHTTPDebugLog(path string) (*HTTPDebugLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPDebugLog{file: f}, nil
+}
+
+// requestTrace collects the timings of one request. Connection attempts to
+// several addresses may run concurrently, hence the mutex.
+type requestTrace struct {
+	mu                   sync.Mutex
+	start                time.Time
+	dnsStart, dnsDone    time.Time
+	connStart, connDone  time.Time
+	tlsStart, tlsDone    time.Time
+	reused, wasIdle      bool
+	protocol             string // Negotiated via ALPN, e.g. "h2"
+	idleTime             time.Duration
+	firstByte            time.Time
+	method, host, path   string
+	connectErr, tlsError error
+}
+
+// Trace returns req with an httptrace attached that logs its connection
+// timings once the first response byte arrives. Only the host and path are
+// logged, never the query string, which may carry signatures.
+func (l *HTTPDebugLog) Trace(req *http.Request) *http.Request {
+	if l == nil {
+		return req
+	}
+	t := &requestTrace{
+		start:  time.Now(),
+		method: req.Method,
+		host:   req.URL.Host,
+		path:   req.URL.Path,
+	}
+	lock := func(f func()) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		f()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { lock(func() { t.dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { lock(func() { t.dnsDone = time.Now() }) },
+		ConnectStart: func(string, string) {
+			lock(func() {
+				if t.connStart.IsZero() {
+					t.connStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			lock(func() {
+				t.connDone = time.Now()
+				t.connectErr = err
+			})
+		},
+		TLSHandshakeStart: func() { lock(func() { t.tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			lock(func() {
+				t.tlsDone = time.Now()
+				t.tlsError = err
+			})
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			lock(func() {
+				t.reused = info.Reused
+				t.wasIdle = info.WasIdle
+				t.idleTime = info.IdleTime
+				if tlsConn, ok := info.Conn.(*tls.Conn); ok {
+					t.protocol = tlsConn.ConnectionState().NegotiatedProtocol
+				}
+			})
+		},
+		GotFirstResponseByte: func() {
+			lock(func() { t.firstByte = time.Now() })
+			l.record(t)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+func (l *HTTPDebugLog) record(t *requestTrace) {
+	t.mu.Lock()
+	line := fmt.Sprintf("%s %s %s%s reused=%t", t.start.UTC().Format(time.RFC3339Nano), t.method, t.host, t.path, t.reused)
+	if t.protocol != "" {
+		line += fmt.Sprintf(" proto=%s", t.protocol)
+	}
+	if t.wasIdle {
+		line += fmt.Sprintf(" idle=%s", t.idleTime.Round(time.Millisecond))
+	}
+	if !t.dnsDone.IsZero() {
+		line += fmt.Sprintf(" dns=%s", t.dnsDone.Sub(t.dnsStart).Round(time.Microsecond))
+	}
+	if !t.connDone.IsZero() {
+		line += fmt.Sprintf(" connect=%s", t.connDone.Sub(t.connStart).Round(time.Microsecond))
+	}
+	if !t.tlsDone.IsZero() {
+		line += fmt.Sprintf(" tls=%s", t.tlsDone.Sub(t.tlsStart).Round(time.Microsecond))
+	}
+	line += fmt.Sprintf(" ttfb=%s", t.firstByte.Sub(t.start).Round(time.Microsecond))
+	if t.connectErr != nil {
+		line += fmt.Sprintf(" connect_error=%q", t.connectErr)
+	}
+	if t.tlsError != nil {
+		line += fmt.Sprintf(" tls_error=%q", t.tlsError)
+	}
+	reused := t.reused
+	t.mu.Unlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests++
+	if reused {
+		l.reused++
+	}
+	_, _ = fmt.Fprintln(l.file, line)
+}
+
+// Close writes the connection reuse totals to the log, prints them, and
+// closes the file.
+func (l *HTTPDebugLog) Close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	summary := fmt.Sprintf("%d requests, %d on reused connections, %d on new connections",
+		l.requests, l.reused, l.requests-l.reused)
+	_, _ = fmt.Fprintf(l.file, "%s summary: %s\n", time.Now().UTC().Format(time.RFC3339Nano), summary)
+	_ = l.file.Close()
+	pterm.Info.Printf("HTTP debug: %s (traces in %s).\n", summary, l.file.Name())
+}
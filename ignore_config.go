@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/pterm/pterm"
+)
+
+// maxUnlistedShown is how many downloaded unlisted files the summary names.
+const maxUnlistedShown = 10
+
+// warnIgnoreConfig warns that --ignore-config requests files the embedded
+// metadata doesn't list, which mostly come back as 404s.
+func warnIgnoreConfig(jobs []Job) {
+	unlisted := 0
+	for _, job := range jobs {
+		if job.Unlisted {
+			unlisted++
+		}
+	}
+	pterm.Warning.Printf("--ignore-config: requesting every exchange, token and date without checking the embedded metadata. "+
+		"%d of %d files are not listed in it and may well not exist; expect many 404s.\n", unlisted, len(jobs))
+}
+
+// printUnlistedSummary tells how the files missing from the metadata fared:
+// downloaded ones mean the metadata is stale, 404s mean it was right.
+func printUnlistedSummary(stats RunStats) {
+	var downloaded []string
+	var present, missing, failed int
+	for _, result := range stats.Results {
+		if !result.Unlisted {
+			continue
+		}
+		switch {
+		case result.Status == StatusSuccess:
+			downloaded = append(downloaded, result.Path)
+		case result.Status == StatusSkipped:
+			present++
+		case result.Status == StatusMissing, errors.Is(result.Err, errFileNotFound):
+			missing++
+		case result.Status == StatusFailed:
+			failed++
+		}
+	}
+	if len(downloaded)+present+missing+failed == 0 {
+		return
+	}
+
+	pterm.DefaultSection.Println("Files Not in the Metadata")
+	pterm.Info.Printf("Not found on the server (metadata was right): %d\n", missing)
+	if failed > 0 {
+		pterm.Info.Printf("Failed for another reason: %d\n", failed)
+	}
+	if present > 0 {
+		pterm.Info.Printf("Already present locally: %d\n", present)
+	}
+	if len(downloaded) == 0 {
+		return
+	}
+	pterm.Warning.Printf("Downloaded although the metadata doesn't list them (metadata is stale): %d\n", len(downloaded))
+	for _, path := range downloaded[:min(len(downloaded), maxUnlistedShown)] {
+		pterm.Printf("  %s\n", path)
+	}
+	if len(downloaded) > maxUnlistedShown {
+		pterm.Printf("  ... and %d more\n", len(downloaded)-maxUnlistedShown)
+	}
+}
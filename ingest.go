@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pterm/pterm"
+)
+
+var (
+	errInvalidIngest = errors.New("invalid --ingest target")
+	errNoDuckDB      = errors.New("--ingest needs a build with cgo, which the DuckDB driver requires; build with CGO_ENABLED=1 (make build-duckdb)")
+)
+
+// Ingester loads downloaded files into a DuckDB database (--ingest), one
+// table per data type. Every row is tagged with the exchange, pair and date
+// of its file, and loading a file first deletes the rows of any earlier copy,
+// so a file downloaded again replaces its rows instead of duplicating them.
+// A single connection is opened for the whole run and shared by the workers
+// one file at a time, as DuckDB allows a single writer per database.
+// A nil *Ingester loads nothing.
+type Ingester struct {
+	mu     sync.Mutex
+	dbPath string
+	db     *sql.DB
+	conn   *sql.Conn
+}
+
+// runIngest is the --ingest target of the current invocation.
+var runIngest *Ingester
+
+// duckdbDriver is the database/sql driver name of the DuckDB driver.
+const duckdbDriver = "duckdb"
+
+// parseIngestTarget parses an --ingest value of the form duckdb:PATH and
+// opens the database.
+func parseIngestTarget(spec string) (*Ingester, error) {
+	kind, path, ok := strings.Cut(spec, ":")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("%w %q: expected duckdb:PATH", errInvalidIngest, spec)
+	}
+	if kind != "duckdb" {
+		return nil, fmt.Errorf("%w %q: unsupported database %q (supported: duckdb)", errInvalidIngest, spec, kind)
+	}
+	if !duckdbAvailable {
+		return nil, errNoDuckDB
+	}
+	db, err := sql.Open(duckdbDriver, path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return &Ingester{dbPath: path, db: db, conn: conn}, nil
+}
+
+// Ingest loads the downloaded file of job into the table of the data type.
+func (in *Ingester) Ingest(job Job) error {
+	if in == nil {
+		return nil
+	}
+	file, err := filepath.Abs(job.FullPath)
+	if err != nil {
+		return err
+	}
+	table := sqlIdentifier(dataType)
+	date := job.Date.Format(serverDateFormat)
+	source := fmt.Sprintf("SELECT *, %s AS file_exchange, %s AS file_pair, DATE %s AS file_date FROM read_parquet(%s)",
+		sqlString(job.Exchange), sqlString(job.Pair), sqlString(date), sqlString(file))
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s AS %s LIMIT 0", table, source),
+		fmt.Sprintf("DELETE FROM %s WHERE file_exchange = %s AND file_pair = %s AND file_date = DATE %s",
+			table, sqlString(job.Exchange), sqlString(job.Pair), sqlString(date)),
+		fmt.Sprintf("INSERT INTO %s BY NAME %s", table, source),
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	ctx := context.Background()
+	tx, err := in.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ingesting into %s: %w", in.dbPath, err)
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("ingesting into %s: %w", in.dbPath, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ingesting into %s: %w", in.dbPath, err)
+	}
+	if ingestDelete {
+		return os.Remove(job.FullPath)
+	}
+	return nil
+}
+
+// Close closes the database once every file is loaded.
+func (in *Ingester) Close() error {
+	if in == nil {
+		return nil
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	err := in.conn.Close()
+	if dbErr := in.db.Close(); err == nil {
+		err = dbErr
+	}
+	return err
+}
+
+// closeIngest closes the --ingest database at the end of a run.
+func closeIngest() {
+	if err := runIngest.Close(); err != nil {
+		pterm.Warning.Printf("Ingest: %v\n", err)
+	}
+	runIngest = nil
+}
+
+// closeIngestOnSignal closes the --ingest database and exits when the process
+// is interrupted (Ctrl-C) or terminated, which is how a watch session is
+// normally stopped. A file being loaded is finished first. The returned
+// function stops listening for the signals.
+func closeIngestOnSignal() (stop func()) {
+	in := runIngest
+	if in == nil {
+		return func() {}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigs:
+			pterm.Warning.Printf("Stopping: received %s, closing %s.\n", sig, in.dbPath)
+			if err := in.Close(); err != nil {
+				pterm.Warning.Printf("Ingest: %v\n", err)
+			}
+			// The status a shell reports for a process killed by the signal.
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,9 @@
+//go:build cgo
+
+package main
+
+import _ "github.com/marcboeker/go-duckdb"
+
+// duckdbAvailable reports whether the DuckDB driver is linked in. It needs
+// cgo, as the driver wraps the DuckDB C library.
+const duckdbAvailable = true
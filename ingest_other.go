@@ -0,0 +1,7 @@
+//go:build !cgo
+
+package main
+
+// duckdbAvailable reports that --ingest can't be used: without cgo the DuckDB
+// driver, which wraps the DuckDB C library, isn't linked in.
+const duckdbAvailable = false
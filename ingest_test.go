@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+func TestParseIngestTargetRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"duckdb", "duckdb:", "sqlite:./data.db", "./data.db"} {
+		if _, err := parseIngestTarget(spec); !errors.Is(err, errInvalidIngest) {
+			t.Errorf("parseIngestTarget(%q) = %v, want %v", spec, err, errInvalidIngest)
+		}
+	}
+}
+
+// ingestTestJob writes a parquet file of rows rows and returns its job.
+func ingestTestJob(t *testing.T, dir, pair string, rows int) Job {
+	t.Helper()
+	job := Job{
+		Exchange: "binance",
+		Pair:     pair,
+		Date:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		FullPath: filepath.Join(dir, pair+".parquet"),
+	}
+	if err := os.WriteFile(job.FullPath, previewTestFile(t, rows, rows), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestIngestReplacesRowsOfReloadedFile(t *testing.T) {
+	if !duckdbAvailable {
+		t.Skip("the DuckDB driver needs cgo")
+	}
+	saved := dataType
+	dataType = "trade"
+	t.Cleanup(func() { dataType = saved })
+	dir := t.TempDir()
+	in, err := parseIngestTarget("duckdb:" + filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	for _, job := range []Job{
+		ingestTestJob(t, dir, "btc_usdt", 10),
+		ingestTestJob(t, dir, "eth_usdt", 5),
+		ingestTestJob(t, dir, "btc_usdt", 7),
+	} {
+		if err := in.Ingest(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var btc, eth int
+	row := in.conn.QueryRowContext(context.Background(),
+		`SELECT count(*) FILTER (WHERE file_pair = 'btc_usdt'), count(*) FILTER (WHERE file_pair = 'eth_usdt') FROM "trade"`)
+	if err := row.Scan(&btc, &eth); err != nil {
+		t.Fatal(err)
+	}
+	if btc != 7 || eth != 5 {
+		t.Errorf("btc_usdt, eth_usdt rows = %d, %d, want 7, 5", btc, eth)
+	}
+}
+
+func TestIngestFailureLetsRetryLoadFile(t *testing.T) {
+	if !duckdbAvailable {
+		t.Skip("the DuckDB driver needs cgo")
+	}
+	savedType, savedURL, savedPlain := dataType, apiURL, plainOutput
+	dataType, plainOutput = "trade", true
+	t.Cleanup(func() { dataType, apiURL, plainOutput = savedType, savedURL, savedPlain })
+	valid := previewTestFile(t, 10, 10)
+	downloads := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/link" {
+			fmt.Fprintf(w, `{"download_url":%q,"file_size":0}`, srv.URL+"/file")
+			return
+		}
+		// The first copy is corrupt, so loading it fails.
+		downloads++
+		if downloads == 1 {
+			_, _ = w.Write(bytes.Repeat([]byte("x"), len(valid)))
+			return
+		}
+		_, _ = w.Write(valid)
+	}))
+	defer srv.Close()
+	apiURL = srv.URL + "/link"
+	dir := t.TempDir()
+	in, err := parseIngestTarget("duckdb:" + filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	runIngest = in
+	t.Cleanup(func() { runIngest = nil })
+	job := Job{
+		Exchange: "binance",
+		Pair:     "btc_usdt",
+		Date:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		RelPath:  "binance/trade/2025/01/01/btc_usdt/binance_trades_2025-01-01_btc_usdt.parquet",
+		FullPath: filepath.Join(dir, "btc_usdt.parquet"),
+		Bar:      pterm.DefaultProgressbar.WithWriter(io.Discard),
+	}
+
+	if result := processJob(job); result.Status != StatusFailed {
+		t.Fatalf("first attempt status = %v, want failed", result.Status)
+	}
+	if fileExists(job.FullPath) {
+		t.Fatal("file that failed to load was kept, so the retry would skip it")
+	}
+	if result := processJob(job); result.Status != StatusSuccess {
+		t.Fatalf("retry status = %v (%v), want success", result.Status, result.Err)
+	}
+
+	var rows int
+	if err := in.conn.QueryRowContext(context.Background(), `SELECT count(*) FROM "trade"`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 10 {
+		t.Errorf("rows = %d, want 10", rows)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// checkLatestFlags rejects the flags --latest replaces or can't work with.
+func checkLatestFlags(cmd *cobra.Command) error {
+	for _, flag := range []string{"start-date", "end-date", "watch"} {
+		if cmd.Flags().Changed(flag) {
+			return fmt.Errorf("--latest cannot be combined with --%s", flag)
+		}
+	}
+	if mode != "day" {
+		return errors.New("--latest requires --mode day")
+	}
+	if latestLookback < 0 {
+		return errors.New("--latest-lookback must not be negative")
+	}
+	return nil
+}
+
+// findLatestDate walks back from today, at most --latest-lookback days, and
+// returns the first date on which every requested file is on the server. It
+// probes by fetching download links, which land in the --link-cache if one is
+// set. A date with only some files published is passed over, since its
+// missing files are most likely still being uploaded.
+func findLatestDate(configRules []ConfigRule) time.Time {
+	first := today()
+	last := first.AddDate(0, 0, -latestLookback)
+	for date := first; !date.Before(last); date = date.AddDate(0, 0, -1) {
+		jobs := collectJobs(date, date, configRules)
+		if len(jobs) == 0 {
+			continue
+		}
+		for i := range jobs {
+			jobs[i].RelPath = getRelativePath(jobs[i].Exchange, jobs[i].Pair, dataType, date)
+		}
+
+		spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Checking %s (%d files)...", date.Format(serverDateFormat), len(jobs)))
+		missing, err := probeMissing(jobs)
+		_ = spinner.Stop()
+		if err != nil {
+			saveLinkCache()
+			pterm.Error.Printf("Could not check %s: %v\n", date.Format(serverDateFormat), err)
+			os.Exit(1)
+		}
+		if missing == 0 {
+			saveLinkCache()
+			pterm.Success.Printf("Latest date with all files: %s\n", date.Format(serverDateFormat))
+			return date
+		}
+		pterm.Info.Printf("%s: %d of %d files not on the server yet\n", date.Format(serverDateFormat), missing, len(jobs))
+	}
+	saveLinkCache()
+	pterm.Error.Printf("No date from %s to %s has all requested files (--latest-lookback %d).\n",
+		last.Format(serverDateFormat), first.Format(serverDateFormat), latestLookback)
+	os.Exit(1)
+	return time.Time{}
+}
+
+// probeMissing fetches the download link of every job and returns how many
+// are not on the server. Any error other than a 404 is returned, as it says
+// nothing about whether the file exists.
+func probeMissing(jobs []Job) (int, error) {
+	var (
+		mu       sync.Mutex
+		missing  int
+		firstErr error
+	)
+	forEachParallel(len(jobs), parallelism, func(idx int) {
+		_, _, err := cachedDownloadLink(jobs[idx].RelPath)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case errors.Is(err, errFileNotFound):
+			missing++
+		case err != nil && firstErr == nil:
+			firstErr = fmt.Errorf("%s: %w", jobs[idx].RelPath, err)
+		}
+	})
+	return missing, firstErr
+}
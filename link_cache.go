@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// linkExpiryMargin is how long a cached link must still be valid to be used;
+// a link about to expire would likely fail mid-download.
+const linkExpiryMargin = 2 * time.Minute
+
+// linkExpiryWarning is how far ahead --no-download warns about expiring
+// links, roughly the time a team needs to start a coordinated download.
+const linkExpiryWarning = time.Hour
+
+type linkCacheEntry struct {
+	URL       string    `json:"url"`
+	Size      int64     `json:"size"`
+	FetchedAt time.Time `json:"fetched_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // Zero if the link doesn't say
+}
+
+// LinkCache stores presigned download links by server path (--link-cache),
+// so the API-limited link fetches can happen separately from the downloads,
+// or on another machine. A nil *LinkCache is valid and caches nothing; one
+// without a path lives in memory only.
+type LinkCache struct {
+	mu      sync.Mutex
+	path    string // Empty for an in-memory cache
+	entries map[string]linkCacheEntry
+}
+
+// runLinkCache is the --link-cache of the current invocation.
+var runLinkCache *LinkCache
+
+// loadLinkCache reads the cache at path. A missing file yields an empty cache.
+func loadLinkCache(path string) (*LinkCache, error) {
+	c := &LinkCache{path: path, entries: make(map[string]linkCacheEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// newMemoryLinkCache returns a cache that is never saved, for reusing links
+// within a single run.
+func newMemoryLinkCache() *LinkCache {
+	return &LinkCache{entries: make(map[string]linkCacheEntry)}
+}
+
+// Get returns the cached link for relPath unless it is missing or expires
+// within linkExpiryMargin.
+func (c *LinkCache) Get(relPath string) (string, int64, bool) {
+	if c == nil {
+		return "", 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[relPath]
+	if !ok || (!entry.ExpiresAt.IsZero() && time.Until(entry.ExpiresAt) < linkExpiryMargin) {
+		return "", 0, false
+	}
+	return entry.URL, entry.Size, true
+}
+
+// Put stores a freshly fetched link.
+func (c *LinkCache) Put(relPath, link string, size int64) {
+	if c == nil {
+		return
+	}
+	now := time.Now().UTC()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[relPath] = linkCacheEntry{URL: link, Size: size, FetchedAt: now, ExpiresAt: linkExpiry(link)}
+}
+
+// ExpiresAt returns when the cached link for relPath expires, or the zero time
+// if that is unknown.
+func (c *LinkCache) ExpiresAt(relPath string) time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[relPath].ExpiresAt
+}
+
+// Save writes the cache back to its file, replacing it atomically.
+func (c *LinkCache) Save() error {
+	if c == nil || c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Links are kept readable rather than having & escaped as \u0026.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c.entries); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// saveLinkCache saves the --link-cache after a batch, warning on failure.
+func saveLinkCache() {
+	if err := runLinkCache.Save(); err != nil {
+		pterm.Warning.Printf("Failed to save link cache: %v\n", err)
+	}
+}
+
+// linkExpiry returns when a presigned link stops working, read from its
+// query string: X-Amz-Date plus X-Amz-Expires for S3 signatures, or an Expires
+// Unix timestamp for CloudFront and older S3 signatures. It returns the zero
+// time if the link doesn't say.
+func linkExpiry(link string) time.Time {
+	u, err := url.Parse(link)
+	if err != nil {
+		return time.Time{}
+	}
+	q := u.Query()
+	if signed, err := time.Parse("20060102T150405Z", q.Get("X-Amz-Date")); err == nil {
+		if seconds, err := strconv.Atoi(q.Get("X-Amz-Expires")); err == nil {
+			return signed.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	if unix, err := strconv.ParseInt(q.Get("Expires"), 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC()
+	}
+	return time.Time{}
+}
+
+// cachedDownloadLink returns the download link for relPath from the
+// --link-cache, fetching and caching it if there is no usable entry.
+func cachedDownloadLink(relPath string) (string, int64, error) {
+	if link, size, ok := runLinkCache.Get(relPath); ok {
+		return link, size, nil
+	}
+	link, size, err := fetchDownloadLink(apiKey, relPath)
+	if err == nil {
+		runLinkCache.Put(relPath, link, size)
+	}
+	return link, size, err
+}
+
+// warmLinkCache fetches the download link of every job into the --link-cache
+// without downloading anything (--no-download), and warns about links that
+// will expire soon.
+func warmLinkCache(jobs []Job) {
+	spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Fetching links of %d files...", len(jobs)))
+
+	errs := make([]error, len(jobs))
+	forEachParallel(len(jobs), parallelism, func(idx int) {
+		_, _, errs[idx] = cachedDownloadLink(jobs[idx].RelPath)
+	})
+	_ = spinner.Stop()
+
+	if err := runLinkCache.Save(); err != nil {
+		pterm.Error.Printf("Failed to save link cache: %v\n", err)
+		os.Exit(1)
+	}
+
+	var cached, missing, failed, expiringSoon int
+	var earliest time.Time
+	for i, err := range errs {
+		switch {
+		case errors.Is(err, errFileNotFound):
+			missing++
+			continue
+		case err != nil:
+			failed++
+			pterm.Warning.Printf("%s: %v\n", jobs[i].RelPath, err)
+			continue
+		}
+		cached++
+		expires := runLinkCache.ExpiresAt(jobs[i].RelPath)
+		if expires.IsZero() {
+			continue
+		}
+		if earliest.IsZero() || expires.Before(earliest) {
+			earliest = expires
+		}
+		if time.Until(expires) < linkExpiryWarning {
+			expiringSoon++
+		}
+	}
+
+	pterm.Success.Printf("Cached %d links in %s (missing on server: %d, failed: %d).\n", cached, runLinkCache.path, missing, failed)
+	if !earliest.IsZero() {
+		pterm.Info.Printf("The earliest link expires at %s (in %s).\n",
+			earliest.In(location).Format(time.DateTime), time.Until(earliest).Round(time.Minute))
+	}
+	if expiringSoon > 0 {
+		pterm.Warning.Printf("%d links expire within %s; start the download soon or expired links will be fetched again.\n",
+			expiringSoon, linkExpiryWarning)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listType          string
+	listDate          string
+	listExchanges     []string
+	listSearch        string
+	listPageSize      int
+	listNoInteractive bool
+)
+
+func newListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the exchanges and pairs available on a date",
+		Long: `Lists every exchange and token pair in the embedded metadata for a date
+(today by default). In a terminal, long lists are shown a page at a time.`,
+		Run: runList,
+	}
+	cmd.Flags().StringVar(&listType, "type", "trade", "Data type: "+strings.Join(supportedDataTypes(), ", "))
+	cmd.Flags().StringVar(&listDate, "date", "", "Date (YYYY-MM-DD) to list availability for (default today, UTC)")
+	cmd.Flags().StringSliceVar(&listExchanges, "exchanges", nil, "Only list these exchanges")
+	cmd.Flags().StringVar(&listSearch, "search", "", "Only list pairs or exchanges containing this text (case-insensitive)")
+	cmd.Flags().IntVar(&listPageSize, "page-size", 0, "Rows per page in interactive mode (default fits the terminal)")
+	cmd.Flags().BoolVar(&listNoInteractive, "no-interactive", false, "Print the whole list at once, without paging")
+	return cmd
+}
+
+func runList(cmd *cobra.Command, args []string) {
+	if _, ok := dataTypeFileParts[listType]; !ok {
+		pterm.Error.Printf("Unknown data type: %s. Supported types: %s\n", listType, strings.Join(supportedDataTypes(), ", "))
+		os.Exit(1)
+	}
+
+	date := time.Now().UTC().Truncate(24 * time.Hour)
+	if listDate != "" {
+		var err error
+		date, err = time.Parse(serverDateFormat, listDate)
+		if err != nil {
+			pterm.Error.Printf("Invalid date: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	rules, err := loadConfigRules(listType)
+	if err != nil {
+		pterm.Error.Printf("Failed to load metadata configurations: %v\n", err)
+		os.Exit(1)
+	}
+	config := getConfigForDate(rules, date)
+	if config == nil {
+		pterm.Warning.Printf("No %s data is available on %s.\n", listType, date.Format(serverDateFormat))
+		if len(rules) > 0 {
+			pterm.Info.Printf("The earliest date with %s data is %s.\n", listType, earliestSupportedDate(rules, time.UTC).Format(serverDateFormat))
+		}
+		return
+	}
+
+	rows := listRows(config, listExchanges, listSearch)
+	pterm.Info.Printf("%d pairs available on %s\n", len(rows), date.Format(serverDateFormat))
+	if len(rows) == 0 {
+		return
+	}
+
+	interactive := !listNoInteractive && isTerminal(os.Stdout) && isTerminal(os.Stdin)
+	pageSize := listPageSize
+	if pageSize <= 0 {
+		// Leave room for the table header and the paging prompt.
+		pageSize = max(pterm.GetTerminalHeight()-6, 5)
+	}
+	if !interactive || len(rows) <= pageSize {
+		renderListTable(rows)
+		return
+	}
+	pageList(rows, pageSize)
+}
+
+// listRows returns the sorted exchange/pair rows of config, keeping only the
+// given exchanges (if any) and rows containing search.
+func listRows(config Config, exchangeFilter []string, search string) [][]string {
+	search = strings.ToLower(search)
+	var rows [][]string
+	for exchange, pairs := range config {
+		if len(exchangeFilter) > 0 && !contains(exchangeFilter, exchange) {
+			continue
+		}
+		for _, pair := range pairs {
+			if search != "" && !strings.Contains(strings.ToLower(exchange+" "+pair), search) {
+				continue
+			}
+			rows = append(rows, []string{exchange, pair})
+		}
+	}
+	slices.SortFunc(rows, func(a, b []string) int {
+		if c := strings.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		return strings.Compare(a[1], b[1])
+	})
+	return rows
+}
+
+func renderListTable(rows [][]string) {
+	tableData := pterm.TableData{{"Exchange", "Pair"}}
+	tableData = append(tableData, rows...)
+	renderTable(pterm.DefaultTable.WithHasHeader().WithData(tableData))
+}
+
+// pageList shows rows a page at a time until the user quits or moves past the
+// last page.
+func pageList(rows [][]string, pageSize int) {
+	pages := (len(rows) + pageSize - 1) / pageSize
+	prompt := pterm.DefaultInteractiveContinue.
+		WithOptions([]string{"next", "previous", "quit"}).
+		WithHandles([]string{"n", "p", "q"})
+
+	for page := 0; page < pages; {
+		from := page * pageSize
+		renderListTable(rows[from:min(from+pageSize, len(rows))])
+
+		answer, err := prompt.Show(fmt.Sprintf("Page %d/%d", page+1, pages))
+		if err != nil {
+			return
+		}
+		switch answer {
+		case "previous":
+			page = max(page-1, 0)
+		case "quit":
+			return
+		default:
+			page++
+		}
+	}
+}
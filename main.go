@@ -1,22 +1,32 @@
 package main
 
 import (
+	"compress/gzip"
 	"embed"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	// Embed the timezone database so --timezone works on systems without one
+	// (notably Windows).
+	_ "time/tzdata"
+
 	"github.com/joho/godotenv"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 //go:embed all:metadata
@@ -24,23 +34,161 @@ var configFS embed.FS
 
 type Config map[string][]string
 
+// serverDateFormat is the date layout used in server-side file paths.
+const serverDateFormat = "2006-01-02"
+
+// dataTypeFileParts maps each supported data type (the folder segment of the
+// server path) to the segment used in its filenames. Every type listed here
+// needs a matching metadata/<type> folder.
+var dataTypeFileParts = map[string]string{
+	"trade":      "trades",
+	"derivative": "derivative",
+}
+
+// Supported values of the --layout flag.
+const (
+	layoutNative = "native"
+	layoutHive   = "hive"
+)
+
+// runDirFormat names the per-run subdirectory of --timestamped-output. It
+// avoids colons, which Windows doesn't allow in paths.
+const runDirFormat = "2006-01-02T15-04-05"
+
+// Supported values of the --flatten-by flag.
+var flattenKeys = []string{"exchange", "date", "pair"}
+
+// Bounds for the --buffer-size flag.
+const (
+	defaultBufferSize = 256 * 1024
+	minBufferSize     = 4 * 1024
+	maxBufferSize     = 64 * 1024 * 1024
+)
+
 type ConfigRule struct {
+	Name      string // File name in metadata/<type>, e.g. _2025_01_01.json
 	StartDate time.Time
 	Config    Config
 }
 
 var (
-	mode        string
-	dataType    string
-	exchanges   []string
-	tokens      []string
-	startDate   string
-	endDate     string
-	skipConfirm bool
-	apiKey      string
-	parallelism int
+	mode               string
+	dataType           string
+	exchanges          []string
+	tokens             []string
+	filterExpr         string
+	pairIncludeRegex   string
+	pairExcludeRegex   string
+	ignoreConfig       bool
+	startDate          string
+	endDate            string
+	skipConfirm        bool
+	confirmThreshold   int
+	apiKey             string
+	apiKeyFile         string
+	apiKeyCmd          string
+	parallelism        int
+	maxOpenFiles       int
+	rateLimit          string
+	dateFormat         string
+	watch              bool
+	pollInterval       time.Duration
+	statsInterval      time.Duration
+	bufferSize         int
+	autoRetryFailed    bool
+	resume             bool
+	noAtomic           bool
+	dirModeFlag        string
+	fileModeFlag       string
+	explain            bool
+	progressThreshold  int64
+	archivePath        string
+	ingestTarget       string
+	ingestDelete       bool
+	compressLevel      int
+	summaryExport      string
+	summaryTemplate    string
+	abortAfterFailures int
+	keepGoing          bool
+	jsonOutput         bool
+	linkCachePath      string
+	summarizeByDate    bool
+	configVersion      string
+	manifestOnlyPath   string
+	savePlanPath       string
+	executePlanPath    string
+	replayLogPath      string
+	latest             bool
+	latestLookback     int
+	useHTTP2           bool
+	pathPairDelimiter  string
+	sequenceFile       string
+	simulateFailures   string
+	manifestPath       string
+	includeHeaders     bool
+	skipByETag         bool
+	noDownload         bool
+	bundleDownload     bool
+	bundlePathTemplate string
+	quietOutput        bool
+	layout             string
+	flattenBy          string
+	timestampedOutput  bool
+	timezone           string
+	touchMissing       bool
+	failOnMissing      bool
+	minFileSize        int64
+	dropSmall          bool
+	apiURL             string
+	apiURLMirrors      []string
+	outputDir          string
+	profile            string
+	configPath         string
+	verifyResume       bool
+	maxDuration        time.Duration
+	resultsFile        string
+	refreshOlderThan   time.Duration
+	newerThanValue     string
+	newerThanFile      string
+	maxRetriesPerFile  int
+	maxTotalRetries    int
+	apiParams          []string
+	normalizeOutput    bool
+	bundlePath         string
+	requireAPIKey      bool
+	splitParts         int
+	splitThreshold     int64
+	tokenMappingPath   string
+	auditLogPath       string
+	debugHTTP          bool
+	logFile            string
+	dryRun             bool
+	estimateSizes      bool
 )
 
+// location is the timezone in which dates are interpreted (--timezone).
+var location = time.UTC
+
+// plainOutput is set when stdout is not a terminal and progress bars are
+// replaced by one line per finished job.
+var plainOutput bool
+
+// extraAPIParams holds the parsed --api-param values.
+var extraAPIParams url.Values
+
+// runDeadline is when --max-duration runs out. No new jobs are started after
+// it; the zero value means no limit.
+var runDeadline time.Time
+
+// runArchive receives every completed file when --archive is set.
+var runArchive *Archive
+
+// resumeState holds what the checkpoint recorded when --resume is set.
+var resumeState CheckpointState
+
+// runCheckpoint records the progress of the batch being downloaded.
+var runCheckpoint *Checkpoint
+
 func main() {
 	_ = godotenv.Load()
 
@@ -52,14 +200,133 @@ func main() {
 	}
 
 	rootCmd.Flags().StringVar(&mode, "mode", "day", "Data mode: day, check")
-	rootCmd.Flags().StringVar(&dataType, "type", "trade", "Data type: trade (default), derivative")
+	rootCmd.Flags().StringVar(&dataType, "type", "trade", "Data type: trade (default), derivative (alias: --data-type)")
 	rootCmd.Flags().StringSliceVar(&exchanges, "exchanges", []string{}, "Comma-separated list of exchanges")
 	rootCmd.Flags().StringSliceVar(&tokens, "tokens", []string{}, "Comma-separated list of token pairs")
-	rootCmd.Flags().StringVar(&startDate, "start-date", "", "Start date (YYYY-MM-DD)")
+	rootCmd.Flags().BoolVar(&ignoreConfig, "ignore-config", false, "Request every exchange, token and date given, even if the embedded metadata doesn't list them (expect 404s)")
+	rootCmd.Flags().StringVar(&filterExpr, "filter", "", "Select exchanges and pairs with an SQL-like expression, e.g. \"exchange in (binance, bybit) and pair like '%_usdt'\"")
+	rootCmd.Flags().StringVar(&pairIncludeRegex, "pair-include-regex", "", "Instead of --tokens, select the pairs of the exchanges matching this regular expression, e.g. '_usdt$'")
+	rootCmd.Flags().StringVar(&pairExcludeRegex, "pair-exclude-regex", "", "Instead of --tokens, leave out the pairs of the exchanges matching this regular expression, e.g. '^test_'")
+	rootCmd.Flags().StringVar(&bundlePath, "bundle", "", "Dataset bundle file describing exchanges, tokens, mode and range")
+	rootCmd.Flags().StringVar(&startDate, "start-date", "", "Start date (YYYY-MM-DD), or end-Nd for N days before --end-date")
 	rootCmd.Flags().StringVar(&endDate, "end-date", "", "End date (YYYY-MM-DD)")
+	rootCmd.Flags().BoolVar(&latest, "latest", false, "Download the most recent date whose files are all on the server, instead of a date range")
+	rootCmd.Flags().IntVar(&latestLookback, "latest-lookback", 7, "With --latest, how many days before today to look back at most")
+	rootCmd.Flags().StringVar(&timezone, "timezone", "UTC", "IANA timezone in which dates are interpreted (e.g. America/New_York)")
 	rootCmd.Flags().BoolVarP(&skipConfirm, "yes", "y", false, "Skip confirmation prompts")
-	rootCmd.Flags().StringVar(&apiKey, "api-key", "", "API Key (overrides API_KEY env var)")
+	rootCmd.Flags().IntVar(&confirmThreshold, "confirm-threshold", 0, "Only ask for confirmation when there are more than this many files (0 = always ask)")
+	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", "", "API Key (overrides API_KEY env var)")
+	rootCmd.Flags().BoolVar(&requireAPIKey, "require-api-key", false, "Fail instead of warning when the API key is missing or malformed")
+	rootCmd.PersistentFlags().StringVar(&apiKeyFile, "api-key-file", "", "Read the API key from this file (keep it chmod 600)")
+	rootCmd.PersistentFlags().StringVar(&apiKeyCmd, "api-key-cmd", "", "Run this shell command and use its output as the API key (e.g. a password manager)")
+	rootCmd.PersistentFlags().StringVar(&apiURL, "api-url", defaultAPIURL, "Base URL of the download API")
+	rootCmd.PersistentFlags().StringSliceVar(&apiURLMirrors, "api-url-mirrors", nil, "Further API base URLs to fail over to, in order, when --api-url is down")
+	rootCmd.Flags().StringArrayVar(&apiParams, "api-param", nil, "Extra query parameter for the API request, as key=value (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&outputDir, "output-dir", defaultOutputDir, "Directory downloaded files are saved to")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Use the api-url, api-key and output-dir of this profile from the config file")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", defaultConfigFile, "Path to the config file")
 	rootCmd.Flags().IntVarP(&parallelism, "parallel", "p", 10, "Number of parallel downloads")
+	rootCmd.Flags().StringVar(&rateLimit, "rate-limit", "", "Maximum link requests per second, per exchange and/or overall, e.g. binance=5,bybit=10,20")
+	rootCmd.Flags().IntVar(&maxOpenFiles, "max-open-files", 0, "Maximum number of output files open at once, separately from --parallel (0 = no limit)")
+	rootCmd.Flags().StringVar(&dateFormat, "date-format", serverDateFormat, "Go time layout for the date in local filenames")
+	rootCmd.Flags().StringVar(&pathPairDelimiter, "path-pair-delimiter", "", "Delimiter the server uses between the tokens of a pair in file paths, e.g. - for btc-usdt (default: as given)")
+	rootCmd.Flags().StringVar(&configVersion, "config-version", "", "Resolve every date against this embedded metadata file, e.g. _2025_01_01.json")
+	rootCmd.Flags().StringVar(&tokenMappingPath, "token-mapping", "", "JSON file mapping server pair names to the names used in local paths")
+	rootCmd.Flags().BoolVar(&normalizeOutput, "normalize-output", false, "Lowercase exchange and pair names and replace filesystem-unsafe characters in local paths")
+	rootCmd.Flags().StringVar(&layout, "layout", layoutNative, "Local directory layout: native (mirrors the server), hive (exchange=/pair=/date=)")
+	rootCmd.Flags().BoolVar(&timestampedOutput, "timestamped-output", false, "Save this run's files in a new subdirectory of --output-dir named after the start time")
+	rootCmd.Flags().StringVar(&flattenBy, "flatten-by", "", "Group all files in one folder per exchange, date or pair instead of the server layout")
+	rootCmd.Flags().BoolVar(&watch, "watch", false, "Keep running and poll for newly available files")
+	rootCmd.Flags().DurationVar(&pollInterval, "poll-interval", time.Hour, "Time to wait between checks in --watch mode")
+	rootCmd.Flags().IntVar(&splitParts, "split", 1, "Download large files in this many parallel byte ranges")
+	rootCmd.Flags().Int64Var(&splitThreshold, "split-threshold", defaultSplitThreshold, "Only files of at least this many bytes are split by --split")
+	rootCmd.Flags().BoolVar(&useHTTP2, "http2", true, "Download over HTTP/2 from servers that support it; --http2=false forces HTTP/1.1")
+	rootCmd.Flags().IntVar(&bufferSize, "buffer-size", defaultBufferSize, "Copy buffer size in bytes used when writing downloads")
+	rootCmd.Flags().BoolVar(&autoRetryFailed, "auto-retry-failed", false, "Retry failed downloads once at the end of the run without prompting")
+	rootCmd.Flags().BoolVar(&resume, "resume", false, "Resume an interrupted batch from its checkpoint")
+	rootCmd.Flags().StringVar(&dirModeFlag, "dir-mode", "", "Octal permissions of the directories created for downloads, e.g. 0775 (default 0755 less the umask)")
+	rootCmd.Flags().StringVar(&fileModeFlag, "file-mode", "", "Octal permissions of downloaded files, e.g. 0664 (default 0644 less the umask)")
+	rootCmd.Flags().BoolVar(&noAtomic, "no-atomic", false, "Write downloads straight to their final path instead of a .part file renamed once complete")
+	rootCmd.Flags().BoolVar(&verifyResume, "verify-resume", false, "Before continuing a partial download, check it still matches the file on the server")
+	rootCmd.Flags().Int64Var(&progressThreshold, "progress-threshold", 1024*1024, "Files smaller than this many bytes download without live progress updates")
+	rootCmd.Flags().StringVar(&archivePath, "archive", "", "Also bundle downloaded files into this archive (.tar, .tar.gz, .tgz or .zip)")
+	rootCmd.Flags().StringVar(&ingestTarget, "ingest", "", "Also load downloaded files into a database table, e.g. duckdb:./data.db (needs a cgo build)")
+	rootCmd.Flags().BoolVar(&ingestDelete, "ingest-delete", false, "With --ingest, delete each parquet file once it is loaded")
+	rootCmd.Flags().IntVar(&compressLevel, "compress-level", defaultCompressLevel, "Gzip level of a .tar.gz --archive, from 1 (fastest) to 9 (smallest)")
+	rootCmd.Flags().StringVar(&resultsFile, "results-file", "", "Append one JSON line per finished job to this file")
+	rootCmd.Flags().StringVar(&sequenceFile, "sequence-file", "", "Prefix local filenames with a sequence number kept in this file, continuing across runs")
+	rootCmd.Flags().StringVar(&manifestPath, "manifest", "", "Record every downloaded file in this JSON manifest, keeping entries from earlier runs")
+	rootCmd.Flags().BoolVar(&includeHeaders, "include-headers-in-manifest", false, "Also record the ETag, Last-Modified and Content-Type the server sent for each file in --manifest")
+	rootCmd.Flags().BoolVar(&skipByETag, "skip-by-etag", false, "Before downloading a file again, skip it if its ETag and size still match --manifest")
+	rootCmd.Flags().StringVar(&auditLogPath, "audit-log", "", "Append request/response metadata of every link fetch and download to this JSONL file")
+	rootCmd.Flags().BoolVar(&debugHTTP, "debug-http", false, "Log connection reuse, DNS, connect and TLS handshake timings of every request to --log-file")
+	rootCmd.Flags().StringVar(&logFile, "log-file", defaultLogFile, "File that diagnostic output such as --debug-http traces is appended to")
+	rootCmd.Flags().BoolVar(&summarizeByDate, "summarize-by-date", false, "Break the run summary down by date, to tell whole-day outages from scattered failures")
+	rootCmd.Flags().StringVar(&summaryExport, "summary-export", "", "Append a summary row for this run to a CSV file")
+	rootCmd.Flags().StringVar(&summaryTemplate, "summary-template", "", "Print the run summary with this Go template file, or a built-in one: default, slack, email")
+	rootCmd.Flags().IntVar(&maxRetriesPerFile, "max-retries-per-file", 0, "Retry a failed download up to this many times before giving up")
+	rootCmd.Flags().IntVar(&maxTotalRetries, "max-total-retries", 0, "Retry budget shared by all files in the batch (0 = unlimited)")
+	rootCmd.Flags().IntVar(&abortAfterFailures, "abort-after-failures", 0, "Stop the batch once this many downloads have failed (0 = never)")
+	rootCmd.Flags().StringVar(&linkCachePath, "link-cache", "", "Reuse download links stored in this JSON file and add newly fetched ones")
+	rootCmd.Flags().BoolVar(&noDownload, "no-download", false, "Only fetch download links into --link-cache, without downloading files")
+	rootCmd.Flags().BoolVar(&bundleDownload, "bundle-download", false, "Fetch one archive per exchange and day instead of each pair's file, where the server offers one")
+	rootCmd.Flags().StringVar(&bundlePathTemplate, "bundle-path-template", "", "Server path of the daily archives for --bundle-download, e.g. {exchange}/{type}/{yyyy}/{mm}/{dd}/{exchange}_{file_part}_{date}.tar.gz")
+	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the run summary as JSON on stdout; everything else goes to stderr")
+	rootCmd.Flags().BoolVarP(&quietOutput, "quiet", "q", false, "Only print failed jobs while downloading, without progress bars")
+	rootCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Work through every job regardless of failures and never wait for input at the end")
+	rootCmd.Flags().DurationVar(&statsInterval, "stats-interval", 0, "Print jobs done, throughput and ETA to stderr this often, e.g. 1m (0 = off)")
+	rootCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Stop starting new downloads after running this long, e.g. 2h (0 = no limit)")
+	rootCmd.Flags().DurationVar(&refreshOlderThan, "refresh-older-than", 0, "Re-download existing files last modified longer ago than this, e.g. 168h (0 = never)")
+	rootCmd.Flags().StringVar(&newerThanValue, "newer-than", "", "Only download files the server modified after this date (YYYY-MM-DD) or RFC 3339 timestamp")
+	rootCmd.Flags().StringVar(&newerThanFile, "newer-than-file", "", "Only download files the server modified after the modification time of this file")
+	rootCmd.Flags().BoolVar(&touchMissing, "touch-missing", false, "Write a zero-byte .missing marker for files the server doesn't have")
+	rootCmd.Flags().BoolVar(&failOnMissing, "fail-on-missing", false, "Exit with a non-zero status if any requested file is missing on the server (404)")
+	rootCmd.Flags().Int64Var(&minFileSize, "min-file-size", 0, "Flag downloaded files smaller than this many bytes as suspiciously small (0 = off)")
+	rootCmd.Flags().BoolVar(&dropSmall, "drop-small", false, "Delete files flagged by --min-file-size instead of keeping them")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the files that would be downloaded, without downloading anything")
+	rootCmd.Flags().BoolVar(&estimateSizes, "estimate", false, "With --dry-run, fetch the download link of every file to report exact sizes and missing files")
+	rootCmd.Flags().StringVar(&manifestOnlyPath, "output-manifest-only", "", "Fetch every download link and write the size, link expiry or 404 of each file to this JSON file, without downloading")
+	rootCmd.Flags().StringVar(&savePlanPath, "save-plan", "", "With --dry-run, save the resolved job list to this JSON file")
+	rootCmd.Flags().StringVar(&executePlanPath, "execute-plan", "", "Download exactly the jobs of a plan saved with --save-plan")
+	rootCmd.Flags().StringVar(&replayLogPath, "replay-from-log", "", "Run again every job recorded in a --results-file, to the same local paths")
+	rootCmd.Flags().BoolVar(&explain, "explain", false, "Print the API request and local path of every job before downloading")
+
+	rootCmd.Flags().StringVar(&simulateFailures, "simulate-failures", "", "TESTING ONLY: randomly fail this fraction of jobs, e.g. rate=0.2 (add ,download=true to download them first)")
+	_ = rootCmd.Flags().MarkHidden("simulate-failures")
+
+	rootCmd.PersistentFlags().StringVar(&tableStyle, "table-style", tableStyleDefault, "How tables are rendered: default, compact, markdown")
+	rootCmd.PersistentFlags().StringVar(&colorMode, "color", colorAuto, "When to use colors: auto, always, never")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if err := expandFlagEnv(cmd); err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		if err := applyColorMode(colorMode); err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		if err := validateTableStyle(tableStyle); err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	rootCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "data-type" {
+			name = "type"
+		}
+		return pflag.NormalizedName(name)
+	})
+
+	rootCmd.AddCommand(newCheckLocalCmd())
+	rootCmd.AddCommand(newRepairCmd())
+	rootCmd.AddCommand(newBenchmarkCmd())
+	rootCmd.AddCommand(newValidateRangeCmd())
+	rootCmd.AddCommand(newListCmd())
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(newCompareCmd())
+	rootCmd.AddCommand(newPruneCmd())
+	rootCmd.AddCommand(newPreviewCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -73,28 +340,338 @@ type Job struct {
 	Exchange string
 	Pair     string
 	Date     time.Time
+	RelPath  string // Path requested from the server
+	FullPath string // Local output path
+	Unlisted bool   // Not in the embedded metadata for its date (--ignore-config)
 	Bar      *pterm.ProgressbarPrinter
 }
 
 func run(cmd *cobra.Command, args []string) {
+	if jsonOutput || summaryTemplate != "" {
+		// Keep stdout clean for the JSON or templated summary.
+		redirectOutput(os.Stderr)
+	}
+	if summaryTemplate != "" {
+		if jsonOutput {
+			pterm.Error.Println("--summary-template cannot be combined with --json")
+			os.Exit(1)
+		}
+		var err error
+		runSummaryTemplate, err = loadSummaryTemplate(summaryTemplate)
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		pterm.Error.Printf("Invalid timezone: %v\n", err)
+		os.Exit(1)
+	}
+	location = loc
+
+	if bundlePath != "" {
+		bundle, err := loadBundle(bundlePath)
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		applyBundle(cmd, bundle)
+		printBundle(bundle)
+	}
+
+	if executePlanPath != "" {
+		runPlan, err = loadPlan(executePlanPath)
+		if err == nil {
+			err = applyPlan(cmd, runPlan, "execute-plan")
+		}
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		printPlan(runPlan, executePlanPath)
+	}
+	if replayLogPath != "" {
+		runPlan, err = planFromResultsLog(replayLogPath)
+		if err == nil {
+			err = applyPlan(cmd, runPlan, "replay-from-log")
+		}
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		pterm.Info.Printf("Replaying %s: %d %s files from %s to %s\n",
+			replayLogPath, len(runPlan.Jobs), runPlan.Type, runPlan.StartDate, runPlan.EndDate)
+	}
+
+	if latest {
+		if err := checkLatestFlags(cmd); err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		// Validated as a one-day range ending today; the actual date is
+		// found once the API key is known.
+		startDate = today().Format(serverDateFormat)
+	}
+
 	if startDate == "" {
 		cmd.Help()
 		pterm.Error.Println("\nMissing required argument: --start-date")
 		os.Exit(1)
 	}
 
-	start, err := time.Parse("2006-01-02", startDate)
+	var start, end time.Time
+	if endDate != "" {
+		end, err = time.ParseInLocation("2006-01-02", endDate, location)
+		if err != nil {
+			pterm.Error.Printf("Invalid end date: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if days, ok, err := parseEndOffset(startDate); ok {
+		if err != nil {
+			pterm.Error.Printf("Invalid start date: %v\n", err)
+			os.Exit(1)
+		}
+		if endDate == "" {
+			pterm.Error.Printf("--start-date %s is relative to --end-date, which is missing\n", startDate)
+			os.Exit(1)
+		}
+		start = end.AddDate(0, 0, -days)
+	} else {
+		start, err = time.ParseInLocation("2006-01-02", startDate, location)
+		if err != nil {
+			pterm.Error.Printf("Invalid start date: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if endDate == "" {
+		end = start
+	}
+	if end.Before(start) {
+		pterm.Error.Printf("End date %s is before start date %s\n", end.Format("2006-01-02"), start.Format("2006-01-02"))
+		os.Exit(1)
+	}
+
+	if maxRetriesPerFile < 0 || maxTotalRetries < 0 {
+		pterm.Error.Println("--max-retries-per-file and --max-total-retries must not be negative")
+		os.Exit(1)
+	}
+	runRetries = &RetryBudget{limit: maxTotalRetries}
+
+	if outputDirMode, err = parseFileMode("dir-mode", dirModeFlag); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if outputFileMode, err = parseFileMode("file-mode", fileModeFlag); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	if rateLimit != "" {
+		runRateLimits, err = parseRateLimits(rateLimit)
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if maxOpenFiles < 0 {
+		pterm.Error.Println("--max-open-files must not be negative")
+		os.Exit(1)
+	}
+	if maxOpenFiles > 0 {
+		openFiles = make(chan struct{}, maxOpenFiles)
+	}
+
+	if keepGoing && abortAfterFailures > 0 {
+		pterm.Error.Println("--keep-going cannot be combined with --abort-after-failures")
+		os.Exit(1)
+	}
+
+	if confirmThreshold < 0 {
+		pterm.Error.Println("--confirm-threshold must not be negative")
+		os.Exit(1)
+	}
+
+	if refreshOlderThan < 0 {
+		pterm.Error.Println("--refresh-older-than must not be negative")
+		os.Exit(1)
+	}
+
+	if newerThanValue != "" || newerThanFile != "" {
+		if newerThanValue != "" && newerThanFile != "" {
+			pterm.Error.Println("--newer-than cannot be combined with --newer-than-file")
+			os.Exit(1)
+		}
+		newerThan, err = parseNewerThan(newerThanValue, newerThanFile)
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if compressLevel < gzip.BestSpeed || compressLevel > gzip.BestCompression {
+		pterm.Error.Printf("--compress-level must be between %d and %d\n", gzip.BestSpeed, gzip.BestCompression)
+		os.Exit(1)
+	}
+	if cmd.Flags().Changed("compress-level") && !isGzipArchive(archivePath) {
+		pterm.Error.Println("--compress-level only applies to a .tar.gz or .tgz --archive")
+		os.Exit(1)
+	}
+
+	if splitParts < 1 || splitParts > 32 {
+		pterm.Error.Println("--split must be between 1 and 32")
+		os.Exit(1)
+	}
+
+	if statsInterval < 0 {
+		pterm.Error.Println("--stats-interval must not be negative")
+		os.Exit(1)
+	}
+	if maxDuration < 0 {
+		pterm.Error.Println("--max-duration must not be negative")
+		os.Exit(1)
+	}
+
+	if bufferSize < minBufferSize || bufferSize > maxBufferSize {
+		pterm.Error.Printf("Invalid buffer size: must be between %d and %d bytes\n", minBufferSize, maxBufferSize)
+		os.Exit(1)
+	}
+
+	if layout != layoutNative && layout != layoutHive {
+		pterm.Error.Printf("Unknown layout: %s. Supported layouts: %s, %s\n", layout, layoutNative, layoutHive)
+		os.Exit(1)
+	}
+
+	if flattenBy != "" {
+		if !contains(flattenKeys, flattenBy) {
+			pterm.Error.Printf("Unknown --flatten-by key: %s. Supported keys: %s\n", flattenBy, strings.Join(flattenKeys, ", "))
+			os.Exit(1)
+		}
+		if layout != layoutNative {
+			pterm.Error.Println("--flatten-by cannot be combined with --layout hive")
+			os.Exit(1)
+		}
+	}
+
+	if err := validateDateFormat(dateFormat); err != nil {
+		pterm.Error.Printf("Invalid date format: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, ok := dataTypeFileParts[dataType]; !ok {
+		pterm.Error.Printf("Unknown data type: %s. Supported types: %s\n", dataType, strings.Join(supportedDataTypes(), ", "))
+		os.Exit(1)
+	}
+
+	extraAPIParams, err = parseAPIParams(apiParams)
 	if err != nil {
-		pterm.Error.Printf("Invalid start date: %v\n", err)
+		pterm.Error.Printf("%v\n", err)
 		os.Exit(1)
 	}
-	end := start
-	if endDate != "" {
-		end, err = time.Parse("2006-01-02", endDate)
+
+	if auditLogPath != "" {
+		runAudit, err = openAuditLog(auditLogPath)
 		if err != nil {
-			pterm.Error.Printf("Invalid end date: %v\n", err)
+			pterm.Error.Printf("Failed to open audit log: %v\n", err)
+			os.Exit(1)
+		}
+		defer runAudit.Close()
+	}
+
+	configureDownloadTransport()
+
+	if debugHTTP {
+		runHTTPDebug, err = openHTTPDebugLog(logFile)
+		if err != nil {
+			pterm.Error.Printf("Failed to open log file: %v\n", err)
+			os.Exit(1)
+		}
+		defer runHTTPDebug.Close()
+	}
+
+	if linkCachePath != "" {
+		runLinkCache, err = loadLinkCache(linkCachePath)
+		if err != nil {
+			pterm.Error.Printf("Failed to read link cache: %v\n", err)
+			os.Exit(1)
+		}
+	} else if !newerThan.IsZero() {
+		// The link fetched to check a file's modification time is reused
+		// for its download.
+		runLinkCache = newMemoryLinkCache()
+	}
+
+	if simulateFailures != "" {
+		runSimulation, err = parseFailureSimulation(simulateFailures)
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
 			os.Exit(1)
 		}
+		pterm.Warning.Printf("Simulating failures of %.0f%% of jobs (--simulate-failures is for testing only).\n", runSimulation.Rate*100)
+	}
+
+	if sequenceFile != "" {
+		runSequence, err = loadSequence(sequenceFile)
+		if err != nil {
+			pterm.Error.Printf("Failed to read sequence file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if includeHeaders && manifestPath == "" {
+		pterm.Error.Println("--include-headers-in-manifest requires --manifest")
+		os.Exit(1)
+	}
+	if skipByETag && manifestPath == "" {
+		pterm.Error.Println("--skip-by-etag requires --manifest, where the ETags are kept")
+		os.Exit(1)
+	}
+	if manifestPath != "" {
+		runManifest, err = loadManifest(manifestPath)
+		if err != nil {
+			pterm.Error.Printf("Failed to read manifest: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if ingestDelete && ingestTarget == "" {
+		pterm.Error.Println("--ingest-delete requires --ingest")
+		os.Exit(1)
+	}
+	if ingestDelete && archivePath != "" {
+		pterm.Error.Println("--ingest-delete cannot be combined with --archive")
+		os.Exit(1)
+	}
+	if ingestTarget != "" {
+		runIngest, err = parseIngestTarget(ingestTarget)
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if tokenMappingPath != "" {
+		tokenMapping, err = loadTokenMapping(tokenMappingPath)
+		if err != nil {
+			pterm.Error.Printf("Failed to read token mapping: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := loadUserConfig(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	if timestampedOutput {
+		if resume {
+			pterm.Error.Println("--resume cannot be combined with --timestamped-output; pass the earlier run's directory with --output-dir instead")
+			os.Exit(1)
+		}
+		outputDir = filepath.Join(outputDir, time.Now().In(location).Format(runDirFormat))
 	}
 
 	configRules, err := loadConfigRules(dataType)
@@ -106,18 +683,175 @@ func run(cmd *cobra.Command, args []string) {
 		pterm.Error.Printf("No configuration files found in metadata/%s folder.\n", dataType)
 		os.Exit(1)
 	}
+	if configVersion != "" {
+		configRules, err = pinConfigVersion(configRules, configVersion)
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		pterm.Info.Printf("Using metadata %s for every date (--config-version).\n", configRules[0].Name)
+	}
+
+	// Dates before the oldest config have no data at all; say so instead of
+	// running an empty batch.
+	earliest := earliestSupportedDate(configRules, location)
+	rangeEnd := end
+	if watch && endDate == "" {
+		rangeEnd = today()
+	}
+	if rangeEnd.Before(earliest) && !ignoreConfig {
+		pterm.Error.Printf("No %s data before %s: the requested range %s to %s is not supported.\n",
+			dataType, earliest.Format("2006-01-02"), start.Format("2006-01-02"), rangeEnd.Format("2006-01-02"))
+		os.Exit(1)
+	}
+	if start.Before(earliest) && !ignoreConfig {
+		pterm.Warning.Printf("No %s data before %s; dates from %s to %s are skipped.\n",
+			dataType, earliest.Format("2006-01-02"), start.Format("2006-01-02"), earliest.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+
+	if filterExpr != "" {
+		runFilter, err = parseFilter(filterExpr)
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+	if pairIncludeRegex != "" || pairExcludeRegex != "" {
+		runPairRegex, err = parsePairRegex(pairIncludeRegex, pairExcludeRegex)
+		if err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	switch mode {
 	case "check":
 		runCheckMode(start, end, configRules)
 	case "day":
-		if len(exchanges) == 0 || len(tokens) == 0 {
-			pterm.Error.Println("\nMode 'day' requires: --exchanges and --tokens")
+		if ignoreConfig && runFilter != nil {
+			pterm.Error.Println("--ignore-config cannot be combined with --filter, which is evaluated against the metadata")
+			os.Exit(1)
+		}
+		if runFilter != nil {
+			if len(exchanges) > 0 || len(tokens) > 0 || runPairRegex != nil {
+				pterm.Error.Println("--filter replaces --exchanges, --tokens and the pair regexes and cannot be combined with them")
+				os.Exit(1)
+			}
+			reportFilter(start, end, configRules)
+		} else if runPairRegex != nil {
+			switch {
+			case len(tokens) > 0:
+				pterm.Error.Println("--pair-include-regex and --pair-exclude-regex replace --tokens and cannot be combined with it")
+				os.Exit(1)
+			case ignoreConfig:
+				pterm.Error.Println("--ignore-config cannot be combined with --pair-include-regex or --pair-exclude-regex, which select from the metadata")
+				os.Exit(1)
+			case len(exchanges) == 0:
+				pterm.Error.Println("\n--pair-include-regex and --pair-exclude-regex require --exchanges")
+				os.Exit(1)
+			}
+			reportPairRegex(start, end, configRules)
+		} else if len(exchanges) == 0 || len(tokens) == 0 {
+			pterm.Error.Println("\nMode 'day' requires: --exchanges and --tokens (or --pair-include-regex/--pair-exclude-regex), or --filter")
+			os.Exit(1)
+		}
+		if err := validateNames(exchanges, tokens); err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		if err := validatePairDelimiter(pathPairDelimiter); err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		if _, err := loadAPIKeySource(cmd); err != nil {
+			pterm.Error.Printf("%v\n", err)
 			os.Exit(1)
 		}
 		if apiKey == "" {
 			apiKey = os.Getenv("API_KEY")
 		}
+		if err := checkAPIKeys(); err != nil {
+			if requireAPIKey {
+				pterm.Error.Printf("%v\n", err)
+				os.Exit(1)
+			}
+			pterm.Warning.Printf("%v; requests will likely be rejected\n", err)
+		}
+		if resume && noAtomic {
+			pterm.Error.Println("--no-atomic cannot be combined with --resume, which continues partial downloads from their .part file")
+			os.Exit(1)
+		}
+		if resume {
+			resumeState, err = loadCheckpoint(checkpointPath())
+			if err != nil {
+				pterm.Error.Printf("Failed to read checkpoint: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if estimateSizes && !dryRun {
+			pterm.Error.Println("--estimate requires --dry-run")
+			os.Exit(1)
+		}
+		if savePlanPath != "" && !dryRun {
+			pterm.Error.Println("--save-plan requires --dry-run")
+			os.Exit(1)
+		}
+		if manifestOnlyPath != "" && (dryRun || watch || noDownload || archivePath != "") {
+			pterm.Error.Println("--output-manifest-only cannot be combined with --dry-run, --watch, --no-download or --archive")
+			os.Exit(1)
+		}
+		if bundleDownload && noDownload {
+			pterm.Error.Println("--bundle-download cannot be combined with --no-download")
+			os.Exit(1)
+		}
+		if bundleDownload && bundlePathTemplate == "" {
+			pterm.Error.Println("--bundle-download requires --bundle-path-template, the server path of the daily archives")
+			os.Exit(1)
+		}
+		if bundlePathTemplate != "" && !bundleDownload {
+			pterm.Error.Println("--bundle-path-template requires --bundle-download")
+			os.Exit(1)
+		}
+		if bundleDownload {
+			if err := validateBundlePathTemplate(bundlePathTemplate); err != nil {
+				pterm.Error.Printf("%v\n", err)
+				os.Exit(1)
+			}
+		}
+		if noDownload {
+			if linkCachePath == "" {
+				pterm.Error.Println("--no-download requires --link-cache")
+				os.Exit(1)
+			}
+			if dryRun || watch || archivePath != "" {
+				pterm.Error.Println("--no-download cannot be combined with --dry-run, --watch or --archive")
+				os.Exit(1)
+			}
+		}
+		if watch {
+			if dryRun {
+				pterm.Error.Println("--dry-run cannot be combined with --watch")
+				os.Exit(1)
+			}
+			if archivePath != "" {
+				pterm.Error.Println("--archive cannot be combined with --watch")
+				os.Exit(1)
+			}
+			if failOnMissing {
+				pterm.Error.Println("--fail-on-missing cannot be combined with --watch, which waits for missing files instead")
+				os.Exit(1)
+			}
+			if pollInterval <= 0 {
+				pterm.Error.Println("--poll-interval must be positive")
+				os.Exit(1)
+			}
+			runWatchMode(start, end, configRules)
+			return
+		}
+		if latest {
+			start = findLatestDate(configRules)
+			end = start
+		}
 		runDayMode(start, end, configRules)
 	default:
 		pterm.Error.Printf("Unknown mode: %s. Supported modes: day, check\n", mode)
@@ -157,6 +891,12 @@ func runCheckMode(start, end time.Time, configRules []ConfigRule) {
 					if len(tokens) > 0 && !contains(tokens, pair) {
 						continue
 					}
+					if runFilter != nil && !runFilter.Match(ex, pair) {
+						continue
+					}
+					if runPairRegex != nil && !runPairRegex.Match(pair) {
+						continue
+					}
 					validPairs = append(validPairs, pair)
 				}
 				sort.Strings(validPairs)
@@ -223,11 +963,10 @@ func runCheckMode(start, end time.Time, configRules []ConfigRule) {
 			}
 		}
 
-		pterm.DefaultTable.
+		renderTable(pterm.DefaultTable.
 			WithHasHeader().
 			WithBoxed().
-			WithData(tableData).
-			Render()
+			WithData(tableData))
 
 		pterm.Println()
 	}
@@ -274,11 +1013,130 @@ func isDataEqual(a, b map[string][]string) bool {
 }
 
 func runDayMode(start, end time.Time, configRules []ConfigRule) {
+	var jobs []Job
+	if runPlan != nil {
+		jobs = runPlan.jobs()
+	} else {
+		jobs = buildJobs(start, end, configRules)
+		if ignoreConfig {
+			warnIgnoreConfig(jobs)
+		} else if runFilter == nil {
+			reportUnmatched(start, end, configRules)
+		}
+	}
+	if len(jobs) == 0 {
+		pterm.Warning.Println("No matching files found for the given criteria.")
+		return
+	}
+
+	printJobSummary(jobs)
+	if explain {
+		explainJobs(jobs)
+	}
+	if dryRun {
+		runDryRun(jobs)
+		return
+	}
+	if manifestOnlyPath != "" {
+		writeAvailabilityManifest(jobs, manifestOnlyPath)
+		return
+	}
+	confirmOrExit(len(jobs))
+	if noDownload {
+		warmLinkCache(jobs)
+		return
+	}
+	startDeadline()
+
+	if archivePath != "" {
+		var err error
+		runArchive, err = openArchive(archivePath)
+		if err != nil {
+			pterm.Error.Printf("Failed to create archive: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	pterm.Println()
+	runStart := time.Now()
+	stats := runDownloads(jobs)
+	stats = retryFailedJobs(jobs, stats)
+	printRunSummary(stats)
+	if stats.Failed == 0 && stats.NotStarted == 0 {
+		removeCheckpoint()
+	}
+	printSummaryTemplate(stats, start, end, time.Since(runStart))
+	writeSummaryExport(stats, start, end, time.Since(runStart))
+	saveLinkCache()
+	saveManifest()
+	runMirrors.Report()
+
+	if runArchive != nil {
+		count, errs := runArchive.Close()
+		for _, err := range errs {
+			pterm.Warning.Printf("Archive: %v\n", err)
+		}
+		if ratio := runArchive.CompressionRatio(); ratio > 0 && isGzipArchive(archivePath) {
+			pterm.Info.Printf("Archived %d files to %s (compression level %d, ratio %.2f:1)\n", count, archivePath, compressLevel, ratio)
+		} else {
+			pterm.Info.Printf("Archived %d files to %s\n", count, archivePath)
+		}
+	}
+
+	closeIngest()
+
+	if n := stats.notFound(); failOnMissing && n > 0 {
+		pterm.Error.Printf("%d requested files are missing on the server (--fail-on-missing)\n", n)
+		os.Exit(1)
+	}
+}
+
+// buildJobs expands the requested exchanges and tokens into one job per file
+// available in the embedded config for each date in [start, end].
+func buildJobs(start, end time.Time, configRules []ConfigRule) []Job {
+	jobs := collectJobs(start, end, configRules)
+	numberJobs(jobs)
+	return jobs
+}
+
+// collectJobs returns the exchange, pair and date of every job of buildJobs,
+// without numbering them or resolving their paths.
+func collectJobs(start, end time.Time, configRules []ConfigRule) []Job {
 	var jobs []Job
 	curr := start
 	for !curr.After(end) {
 		activeConfig := getConfigForDate(configRules, curr)
-		if activeConfig != nil {
+		if runFilter != nil {
+			for _, ex := range slices.Sorted(maps.Keys(activeConfig)) {
+				for _, pair := range activeConfig[ex] {
+					if runFilter.Match(ex, pair) {
+						jobs = append(jobs, Job{Exchange: ex, Pair: pair, Date: curr})
+					}
+				}
+			}
+		} else if runPairRegex != nil {
+			for _, ex := range exchanges {
+				ex = strings.TrimSpace(ex)
+				for _, pair := range slices.Sorted(slices.Values(activeConfig[ex])) {
+					if runPairRegex.Match(pair) {
+						jobs = append(jobs, Job{Exchange: ex, Pair: pair, Date: curr})
+					}
+				}
+			}
+		} else if ignoreConfig {
+			for _, ex := range exchanges {
+				ex = strings.TrimSpace(ex)
+				for _, usrPair := range tokens {
+					usrPair = strings.TrimSpace(usrPair)
+					jobs = append(jobs, Job{
+						Exchange: ex,
+						Pair:     usrPair,
+						Date:     curr,
+						Unlisted: !contains(activeConfig[ex], usrPair),
+					})
+				}
+			}
+		} else if activeConfig != nil {
 			for _, ex := range exchanges {
 				ex = strings.TrimSpace(ex)
 				if availablePairs, ok := activeConfig[ex]; ok {
@@ -295,101 +1153,612 @@ func runDayMode(start, end time.Time, configRules []ConfigRule) {
 				}
 			}
 		}
-		curr = curr.AddDate(0, 0, 1)
+		curr = curr.AddDate(0, 0, 1)
+	}
+	return jobs
+}
+
+// numberJobs assigns display indexes and resolves the paths of each job.
+func numberJobs(jobs []Job) {
+	for i := range jobs {
+		jobs[i].Index = i + 1
+		jobs[i].Total = len(jobs)
+		jobs[i].RelPath = getRelativePath(jobs[i].Exchange, jobs[i].Pair, dataType, jobs[i].Date)
+		jobs[i].FullPath = getLocalPath(jobs[i].Exchange, jobs[i].Pair, dataType, jobs[i].Date)
+		if runSequence != nil {
+			jobs[i].FullPath = sequencedPath(jobs[i].FullPath, runSequence.Number(jobs[i].RelPath))
+		}
+	}
+	warnNormalized(jobs)
+}
+
+func printJobSummary(jobs []Job) {
+	pterm.DefaultSection.Println("Job Summary")
+	pterm.Info.Printf("Type: %s\n", dataType)
+	pterm.Info.Printf("Count: %d files\n", len(jobs))
+	pterm.Info.Printf("Concurrency: %d\n", parallelism)
+	pterm.Info.Printf("Range: %s to %s\n", jobs[0].Date.Format("2006-01-02"), jobs[len(jobs)-1].Date.Format("2006-01-02"))
+	reportUnmappedPairs(jobs)
+}
+
+// explainJobs prints the exact link-fetch request and local path of every job
+// so a failure can be reproduced by hand. The API key is never printed.
+func explainJobs(jobs []Job) {
+	pterm.DefaultSection.Println("Explain")
+	for _, job := range jobs {
+		req, err := newLinkRequest(apiKey, job.RelPath)
+		if err != nil {
+			pterm.Error.Printf("[%d/%d] %v\n", job.Index, job.Total, err)
+			continue
+		}
+
+		pterm.Printf("[%d/%d] %s %s on %s\n", job.Index, job.Total, job.Exchange, job.Pair, job.Date.Format("2006-01-02"))
+		pterm.Printf("  Request:    GET %s\n", req.URL)
+		pterm.Printf("  Local path: %s\n", job.FullPath)
+		if exchangeEndpoints[job.Exchange].APIKey != "" {
+			pterm.Printf("  curl:       curl -H 'x-api-key: <key of %s in %s>' '%s'\n", job.Exchange, configPath, req.URL)
+		} else if apiKey != "" {
+			pterm.Printf("  curl:       curl -H 'x-api-key: $API_KEY' '%s'\n", req.URL)
+		} else {
+			pterm.Printf("  curl:       curl '%s'\n", req.URL)
+		}
+	}
+	pterm.Println()
+}
+
+// confirmOrExit asks before downloading jobCount files, unless --yes is set
+// or the batch is within --confirm-threshold.
+func confirmOrExit(jobCount int) {
+	if skipConfirm || jobCount <= confirmThreshold {
+		return
+	}
+	result, _ := pterm.DefaultInteractiveConfirm.Show("Do you want to continue?")
+	if !result {
+		pterm.Warning.Println("Aborted.")
+		os.Exit(0)
+	}
+}
+
+type JobStatus int
+
+const (
+	StatusSuccess JobStatus = iota
+	StatusSkipped
+	StatusFailed
+	StatusNotStarted // The batch stopped before the job was attempted
+	StatusMissing    // The server has no such file and a marker was written
+)
+
+func (s JobStatus) String() string {
+	switch s {
+	case StatusSuccess:
+		return "success"
+	case StatusSkipped:
+		return "skipped"
+	case StatusFailed:
+		return "failed"
+	case StatusNotStarted:
+		return "not_started"
+	case StatusMissing:
+		return "missing"
+	}
+	return fmt.Sprintf("JobStatus(%d)", int(s))
+}
+
+// JobResult is the outcome of processing a single job.
+type JobResult struct {
+	Status JobStatus
+	Bytes  int64 // Bytes downloaded
+	Small  bool  // Smaller than --min-file-size
+	Err    error
+
+	Refreshed bool // An existing file was replaced (--refresh-older-than, --newer-than)
+	NotNewer  bool // Skipped as not modified after --newer-than
+	Retries   int  // Attempts made after the first one failed
+
+	Duration time.Duration // Time spent processing the job
+	Queued   time.Time     // When the scheduler queued the job; zero if it never ran
+	Started  time.Time     // When a worker picked the job up; zero if it never ran
+	Finished time.Time     // When the result was recorded
+	Worker   int           // Worker that ran the job, from 1; 0 if it never ran
+	Path     string        // Local path of the job's file
+	Exchange string        // Exchange of the job's file
+	Date     time.Time     // Date of the job's file
+	Unlisted bool          // The job was not in the embedded metadata
+}
+
+// RunStats aggregates the outcome of a batch of jobs.
+type RunStats struct {
+	Total, Success, Skipped, Failed int64
+	NotStarted, Missing, Refreshed  int64
+	NotNewer                        int64 // Skipped under --newer-than
+	Retries, Recovered              int64 // Retry attempts, and jobs that succeeded after one
+	Bytes                           int64
+	Results                         []JobResult // Per job, in input order
+	SmallFiles                      []string    // Downloads flagged by --min-file-size
+	StopReason                      string      // Why the batch stopped early, if it did
+}
+
+// notFound counts the jobs whose file the server doesn't have, whether they
+// failed or left a --touch-missing marker.
+func (s RunStats) notFound() int {
+	n := 0
+	for _, result := range s.Results {
+		if result.Status == StatusMissing || (result.Status == StatusFailed && errors.Is(result.Err, errFileNotFound)) {
+			n++
+		}
+	}
+	return n
+}
+
+// add counts the outcome of one job into the totals.
+func (s *RunStats) add(result JobResult) {
+	s.Bytes += result.Bytes
+	s.countStatus(result.Status)
+	if result.Refreshed {
+		s.Refreshed++
+	}
+	if result.NotNewer {
+		s.NotNewer++
+	}
+	s.Retries += int64(result.Retries)
+	if result.Retries > 0 && result.Status == StatusSuccess {
+		s.Recovered++
+	}
+}
+
+// failedAfterRetry counts the jobs that still failed after being retried.
+func (s *RunStats) failedAfterRetry() int64 {
+	var n int64
+	for _, result := range s.Results {
+		if result.Status == StatusFailed && result.Retries > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// countStatus adds one job with the given status to the totals.
+func (s *RunStats) countStatus(status JobStatus) {
+	switch status {
+	case StatusSuccess:
+		s.Success++
+	case StatusSkipped:
+		s.Skipped++
+	case StatusFailed:
+		s.Failed++
+	case StatusNotStarted:
+		s.NotStarted++
+	case StatusMissing:
+		s.Missing++
+	}
+}
+
+func runDownloads(jobs []Job) RunStats {
+	saveSequence()
+
+	cp, err := openCheckpoint(checkpointPath())
+	runCheckpoint = cp
+	if err != nil {
+		pterm.Warning.Printf("Checkpointing disabled: %v\n", err)
+	}
+	defer cp.Close()
+
+	var results *ResultsLog
+	if resultsFile != "" {
+		results, err = openResultsLog(resultsFile)
+		if err != nil {
+			pterm.Warning.Printf("Results file disabled: %v\n", err)
+		}
+	}
+	defer results.Close()
+
+	if bundleDownload {
+		runBundles = newBundles(jobs)
+	}
+	defer func() {
+		runBundles.Close()
+		runBundles = nil
+	}()
+
+	// Live bars need a terminal. Otherwise (e.g. output redirected to a log
+	// file) they are discarded and each job prints a single status line.
+	plainOutput = jsonOutput || quietOutput || !isTerminal(os.Stdout)
+	multi := pterm.DefaultMultiPrinter
+	stopResize := func() {}
+	if !plainOutput {
+		multi.Start()
+		stopResize = watchResize(multi.Writer)
+	}
+	newBar := func(total int, title string) *pterm.ProgressbarPrinter {
+		bar := pterm.DefaultProgressbar.WithTotal(total).WithTitle(title).WithBarStyle(barStyleOK)
+		if plainOutput {
+			return bar.WithWriter(io.Discard)
+		}
+		bar, _ = bar.WithWriter(multi.NewWriter()).Start()
+		return bar
+	}
+
+	overall := newBar(len(jobs), "Overall")
+
+	for i := range jobs {
+		jobLabel := fmt.Sprintf("[%d/%d] %s", jobs[i].Index, jobs[i].Total, jobs[i].FullPath)
+		jobs[i].Bar = newBar(100, fmt.Sprintf("%s ... Pending", jobLabel))
+	}
+
+	sched := NewScheduler(jobs)
+	sched.Workers = parallelism
+	sched.MaxFailures = abortAfterFailures
+	sched.Deadline = runDeadline
+	sched.Process = func(job Job) JobResult {
+		jobStart := time.Now()
+		result := runJob(job)
+		result.Duration = time.Since(jobStart)
+		if result.Status != StatusFailed && fileExists(job.FullPath) && !isFIFO(job.FullPath) {
+			runArchive.Add(job.FullPath)
+		}
+		return result
+	}
+	sched.NotStarted = markNotStarted
+	sched.OnResult = func(job Job, result JobResult) {
+		results.Record(job, result)
+		if (result.Status == StatusSuccess || result.Status == StatusSkipped) && fileExists(job.FullPath) && !isFIFO(job.FullPath) {
+			cp.Record(job.FullPath)
+		}
+		overall.Increment()
+	}
+
+	// Jobs completed by a previous, interrupted run count as successes and
+	// start the overall bar where that run left off.
+	var pending []int
+	for i := range jobs {
+		if resumeState.Completed[jobs[i].FullPath] && fileExists(jobs[i].FullPath) {
+			jobLabel := fmt.Sprintf("[%d/%d] %s", jobs[i].Index, jobs[i].Total, jobs[i].FullPath)
+			okPrefix := pterm.Success.Prefix.Style.Sprint(pterm.Success.Prefix.Text)
+			jobs[i].Bar.Total = 1
+			jobs[i].Bar.Increment()
+			finishBar(jobs[i].Bar, fmt.Sprintf("%s %s - Completed (previous run)", okPrefix, jobLabel))
+			runArchive.Add(jobs[i].FullPath)
+			sched.Record(i, JobResult{Status: StatusSuccess})
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	stopStats := startStatsReporter(sched)
+	stats := sched.Run(pending)
+	stopStats()
+	stopResize()
+	if !plainOutput {
+		_, _ = overall.Stop()
+		_, _ = multi.Stop()
+	}
+
+	if stats.StopReason == "" && stats.NotStarted > 0 && sched.DeadlineExceeded() {
+		stats.StopReason = fmt.Sprintf("reached --max-duration of %s", maxDuration)
+	}
+	if stats.StopReason != "" {
+		pterm.Println()
+		pterm.Warning.Printf("Batch %s; %d jobs were not started.\n", stats.StopReason, stats.NotStarted)
+	}
+	return stats
+}
+
+// startDeadline starts the --max-duration clock, if one was requested.
+func startDeadline() {
+	if maxDuration > 0 {
+		runDeadline = time.Now().Add(maxDuration)
+	}
+}
+
+func markNotStarted(job Job) {
+	jobLabel := fmt.Sprintf("[%d/%d] %s", job.Index, job.Total, job.FullPath)
+	skipPrefix := pterm.Warning.Prefix.Style.Sprint(pterm.Warning.Prefix.Text)
+	finishBar(job.Bar, fmt.Sprintf("%s %s - Not started", skipPrefix, jobLabel))
+}
+
+// Bars are green while a job is healthy and turn red if it fails.
+var (
+	barStyleOK     = pterm.NewStyle(pterm.FgGreen)
+	barStyleFailed = pterm.NewStyle(pterm.FgRed)
+)
+
+// failBar finishes a job's bar in the failure color.
+func failBar(bar *pterm.ProgressbarPrinter, title string) {
+	bar.BarStyle = barStyleFailed
+	finishBar(bar, title)
+}
+
+// finishBar sets a job's final status and stops its bar. Without a terminal
+// the bars aren't rendered, so the status is printed as a plain line instead.
+func finishBar(bar *pterm.ProgressbarPrinter, title string) {
+	bar.UpdateTitle(title)
+	if plainOutput {
+		if !quietOutput || bar.BarStyle == barStyleFailed {
+			pterm.Println(title)
+		}
+		return
+	}
+	_, _ = bar.Stop()
+}
+
+// printRunSummary prints the outcome of a batch: the failed jobs with their
+// errors (if any), the number of files that succeeded, and the totals. With
+// --json it prints a single JSON object instead, and with --summary-template
+// nothing, as the template is rendered once the run is over.
+func printRunSummary(stats RunStats) {
+	if jsonOutput {
+		printSummaryJSON(stats)
+		return
+	}
+	if runSummaryTemplate != nil {
+		return
+	}
+
+	pterm.Println()
+	pterm.DefaultHeader.
+		WithBackgroundStyle(pterm.NewStyle(pterm.BgGreen)).
+		WithTextStyle(pterm.NewStyle(pterm.FgBlack)).
+		Println("Finished")
+
+	printFailures(stats)
+	pterm.Println()
+	if stats.NotNewer > 0 {
+		pterm.Success.Printf("Succeeded: %d downloaded, %d already present, %d not newer than the reference\n",
+			stats.Success, stats.Skipped-stats.NotNewer, stats.NotNewer)
+	} else {
+		pterm.Success.Printf("Succeeded: %d downloaded, %d already present\n", stats.Success, stats.Skipped)
+	}
+	pterm.Println()
+
+	row := func(label string, val int64, style *pterm.Style) []string {
+		return []string{style.Sprint(label), style.Sprint(fmt.Sprintf("%d", val))}
+	}
+
+	summaryTable := pterm.TableData{
+		row("Total", stats.Total, pterm.NewStyle(pterm.FgLightBlue)),
+		row("Success", stats.Success, pterm.NewStyle(pterm.FgGreen)),
+		row("Skipped", stats.Skipped, pterm.NewStyle(pterm.FgYellow)),
+		row("Failed", stats.Failed, pterm.NewStyle(pterm.FgRed)),
+	}
+	if stats.Refreshed > 0 {
+		summaryTable = append(summaryTable, row("Refreshed", stats.Refreshed, pterm.NewStyle(pterm.FgCyan)))
+	}
+	if stats.NotNewer > 0 {
+		summaryTable = append(summaryTable, row("Not newer", stats.NotNewer, pterm.NewStyle(pterm.FgYellow)))
+	}
+	if stats.Missing > 0 {
+		summaryTable = append(summaryTable, row("Missing", stats.Missing, pterm.NewStyle(pterm.FgMagenta)))
+	}
+	if stats.NotStarted > 0 {
+		summaryTable = append(summaryTable, row("Not started", stats.NotStarted, pterm.NewStyle(pterm.FgGray)))
+	}
+	if stats.Retries > 0 {
+		retryStyle := pterm.NewStyle(pterm.FgLightYellow)
+		summaryTable = append(summaryTable,
+			row("Retries", stats.Retries, retryStyle),
+			row("Recovered by retry", stats.Recovered, retryStyle),
+			row("Failed after retrying", stats.failedAfterRetry(), retryStyle))
+		if maxTotalRetries > 0 {
+			summaryTable = append(summaryTable, []string{retryStyle.Sprint("Retry budget used"),
+				retryStyle.Sprintf("%d of %d", runRetries.Used(), maxTotalRetries)})
+		}
 	}
+	if len(stats.SmallFiles) > 0 {
+		summaryTable = append(summaryTable, row("Suspiciously small", int64(len(stats.SmallFiles)), pterm.NewStyle(pterm.FgLightRed)))
+	}
+	renderTable(pterm.DefaultTable.WithData(summaryTable))
 
-	if len(jobs) == 0 {
-		pterm.Warning.Println("No matching files found for the given criteria.")
-		return
+	printFailureCategories(stats)
+	printMostRetried(stats)
+	if summarizeByDate {
+		printDateSummary(stats)
+	}
+	if ignoreConfig {
+		printUnlistedSummary(stats)
 	}
 
-	for i := range jobs {
-		jobs[i].Index = i + 1
-		jobs[i].Total = len(jobs)
+	if runRetries.Exhausted() {
+		pterm.Warning.Printf("Retry budget of %d attempts (--max-total-retries) was exhausted; later failures were not retried.\n", maxTotalRetries)
 	}
 
-	pterm.DefaultSection.Println("Job Summary")
-	pterm.Info.Printf("Type: %s\n", dataType)
-	pterm.Info.Printf("Count: %d files\n", len(jobs))
-	pterm.Info.Printf("Concurrency: %d\n", parallelism)
-	pterm.Info.Printf("Range: %s to %s\n", jobs[0].Date.Format("2006-01-02"), jobs[len(jobs)-1].Date.Format("2006-01-02"))
+	if len(stats.SmallFiles) > 0 {
+		verb := "kept"
+		if dropSmall {
+			verb = "deleted"
+		}
+		pterm.Warning.Printf("Suspiciously Small: %d files under %d bytes (%s):\n", len(stats.SmallFiles), minFileSize, verb)
+		for _, path := range stats.SmallFiles {
+			pterm.Println("  " + path)
+		}
+	}
+}
+
+// mostRetriedCount is how many of the most retried jobs the summary lists.
+const mostRetriedCount = 5
 
-	if !skipConfirm {
-		result, _ := pterm.DefaultInteractiveConfirm.Show("Do you want to continue?")
-		if !result {
-			pterm.Warning.Println("Aborted.")
-			os.Exit(0)
+// printMostRetried lists the jobs that needed the most retries, which points
+// at consistently flaky files or endpoints.
+func printMostRetried(stats RunStats) {
+	var retried []JobResult
+	for _, result := range stats.Results {
+		if result.Retries > 0 {
+			retried = append(retried, result)
 		}
 	}
+	if len(retried) == 0 {
+		return
+	}
+	sort.SliceStable(retried, func(i, j int) bool { return retried[i].Retries > retried[j].Retries })
+	retried = retried[:min(len(retried), mostRetriedCount)]
 
+	tableData := pterm.TableData{{"Most retried", "Retries", "Outcome"}}
+	for _, result := range retried {
+		tableData = append(tableData, []string{result.Path, fmt.Sprintf("%d", result.Retries), result.Status.String()})
+	}
 	pterm.Println()
-	runDownloads(jobs)
+	renderTable(pterm.DefaultTable.WithHasHeader().WithData(tableData))
 }
 
-func runDownloads(jobs []Job) {
-	multi := pterm.DefaultMultiPrinter
-	multi.Start()
+// printFailures lists every failed job with its error. Nothing is printed
+// when all jobs succeeded.
+func printFailures(stats RunStats) {
+	if stats.Failed == 0 {
+		return
+	}
+	pterm.DefaultSection.Println("Failures")
+	tableData := pterm.TableData{{"File", "Error"}}
+	for _, result := range stats.Results {
+		if result.Status == StatusFailed {
+			tableData = append(tableData, []string{result.Path, fmt.Sprint(result.Err)})
+		}
+	}
+	renderTable(pterm.DefaultTable.WithHasHeader().WithData(tableData))
+}
 
-	for i := range jobs {
-		relPath := getRelativePath(jobs[i].Exchange, jobs[i].Pair, dataType, jobs[i].Date)
-		fullPath := filepath.Join("downloads", relPath)
-		jobLabel := fmt.Sprintf("[%d/%d] %s", jobs[i].Index, jobs[i].Total, fullPath)
+// printFailureCategories breaks the failed jobs down by error category.
+func printFailureCategories(stats RunStats) {
+	counts := make(map[string]int)
+	for _, result := range stats.Results {
+		if result.Status == StatusFailed {
+			counts[classifyError(result.Err)]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+
+	categories := make([]string, 0, len(counts))
+	for c := range counts {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
 
-		bar, _ := pterm.DefaultProgressbar.
-			WithWriter(multi.NewWriter()).
-			WithTotal(100).
-			WithTitle(fmt.Sprintf("%s ... Pending", jobLabel)).
-			Start()
+	tableData := pterm.TableData{{"Error category", "Failures", "Retryable"}}
+	for _, c := range categories {
+		retryable := "no"
+		if retryableCategory(c) {
+			retryable = "yes"
+		}
+		tableData = append(tableData, []string{c, fmt.Sprint(counts[c]), retryable})
+	}
+	pterm.Println()
+	renderTable(pterm.DefaultTable.WithHasHeader().WithData(tableData))
+}
 
-		jobs[i].Bar = bar
+func writeSummaryExport(stats RunStats, start, end time.Time, duration time.Duration) {
+	if summaryExport == "" {
+		return
+	}
+	if err := exportSummary(summaryExport, stats, start, end, duration); err != nil {
+		pterm.Warning.Printf("Failed to export summary: %v\n", err)
 	}
+}
 
-	jobsCh := make(chan Job, len(jobs))
-	var wg sync.WaitGroup
+// failedIndexes returns the positions of the jobs that failed.
+func (s *RunStats) failedIndexes() []int {
+	var idxs []int
+	for i, result := range s.Results {
+		if result.Status == StatusFailed {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
 
-	var successCount, failCount, skipCount int64
-	var mu sync.Mutex
+// merge replaces the outcome of the jobs at idxs with the results of
+// re-running them.
+func (s *RunStats) merge(idxs []int, retry RunStats) {
+	for i, idx := range idxs {
+		s.Failed--
+		s.add(retry.Results[i])
+		s.Results[idx] = retry.Results[i]
+	}
+	s.SmallFiles = append(s.SmallFiles, retry.SmallFiles...)
+}
 
-	for i := 0; i < parallelism; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for job := range jobsCh {
-				processJob(job, &successCount, &failCount, &skipCount, &mu)
+// retryFailedJobs offers to re-run failed jobs without exiting. With
+// --auto-retry-failed it retries once without prompting; otherwise it lists
+// the failures and asks on an interactive terminal for as long as failures
+// remain. The run summary is printed by the caller once retrying is over, so
+// --json still prints a single document.
+func retryFailedJobs(jobs []Job, stats RunStats) RunStats {
+	interactive := !skipConfirm && !keepGoing && isTerminal(os.Stdin)
+	for stats.Failed > 0 && stats.StopReason == "" {
+		idxs := stats.failedIndexes()
+		if !autoRetryFailed {
+			if !interactive {
+				break
 			}
-		}()
-	}
+			pterm.Println()
+			printFailures(stats)
+			result, _ := pterm.DefaultInteractiveConfirm.Show(fmt.Sprintf("Retry %d failed downloads?", len(idxs)))
+			if !result {
+				break
+			}
+		}
+
+		retryJobs := make([]Job, len(idxs))
+		for i, idx := range idxs {
+			retryJobs[i] = jobs[idx]
+		}
+		pterm.Println()
+		retry := runDownloads(retryJobs)
+		stats.merge(idxs, retry)
+		stats.StopReason = retry.StopReason
 
-	for _, j := range jobs {
-		jobsCh <- j
+		if autoRetryFailed {
+			break
+		}
 	}
-	close(jobsCh)
+	return stats
+}
 
-	wg.Wait()
-	multi.Stop()
+var errJobPanicked = errors.New("job panicked")
 
-	pterm.Println()
-	pterm.DefaultHeader.
-		WithBackgroundStyle(pterm.NewStyle(pterm.BgGreen)).
-		WithTextStyle(pterm.NewStyle(pterm.FgBlack)).
-		Println("Finished")
+// runJob runs processJob, turning a panic (e.g. from a malformed response)
+// into a failed result so one bad job can't take down the whole batch. The
+// stack trace is appended to the --log-file.
+func runJob(job Job) (result JobResult) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		err := fmt.Errorf("%w: %v", errJobPanicked, r)
+		logPanic("job "+job.RelPath, r, debug.Stack())
+		errPrefix := pterm.Error.Prefix.Style.Sprint(pterm.Error.Prefix.Text)
+		failBar(job.Bar, fmt.Sprintf("%s [%d/%d] %s - Failed: %v (stack trace in %s)",
+			errPrefix, job.Index, job.Total, job.FullPath, err, logFile))
+		result = JobResult{Status: StatusFailed, Err: err}
+	}()
+	return processJob(job)
+}
 
-	row := func(label string, val int64, style *pterm.Style) []string {
-		return []string{style.Sprint(label), style.Sprint(fmt.Sprintf("%d", val))}
+// recoverPanic, deferred in a goroutine working for a job, turns a panic into
+// an error in *err, so it fails only that piece of work. what names the work
+// in the --log-file, where the stack trace goes.
+func recoverPanic(err *error, what string) {
+	r := recover()
+	if r == nil {
+		return
 	}
+	logPanic(what, r, debug.Stack())
+	*err = fmt.Errorf("%w: %v", errJobPanicked, r)
+}
 
-	summaryTable := pterm.TableData{
-		row("Total", int64(len(jobs)), pterm.NewStyle(pterm.FgLightBlue)),
-		row("Success", successCount, pterm.NewStyle(pterm.FgGreen)),
-		row("Skipped", skipCount, pterm.NewStyle(pterm.FgYellow)),
-		row("Failed", failCount, pterm.NewStyle(pterm.FgRed)),
+func logPanic(what string, r any, stack []byte) {
+	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
 	}
-	pterm.DefaultTable.WithData(summaryTable).Render()
+	defer f.Close()
+	_, _ = fmt.Fprintf(f, "%s panic in %s: %v\n%s\n",
+		time.Now().UTC().Format(time.RFC3339Nano), what, r, stack)
 }
 
-func processJob(job Job, success, fail, skip *int64, mu *sync.Mutex) {
-	relPath := getRelativePath(job.Exchange, job.Pair, dataType, job.Date)
-	fullPath := filepath.Join("downloads", relPath)
+func processJob(job Job) JobResult {
+	fullPath := job.FullPath
 	jobLabel := fmt.Sprintf("[%d/%d] %s", job.Index, job.Total, fullPath)
 
 	errPrefix := pterm.Error.Prefix.Style.Sprint(pterm.Error.Prefix.Text)
@@ -398,49 +1767,227 @@ func processJob(job Job, success, fail, skip *int64, mu *sync.Mutex) {
 
 	bar := job.Bar
 
-	if _, err := os.Stat(fullPath); err == nil {
-		bar.UpdateTitle(fmt.Sprintf("%s %s - Skipped (Exists)", skipPrefix, jobLabel))
+	refreshing := fileExists(fullPath) && isStale(fullPath)
+	if !newerThan.IsZero() {
+		bar.UpdateTitle(fmt.Sprintf("%s %s ... Checking modification time", pterm.LightBlue("LOADING"), jobLabel))
+		switch decision, modified := decideNewerThan(job); decision {
+		case newerThanNotNewer:
+			bar.Total = 1
+			bar.Increment()
+			finishBar(bar, fmt.Sprintf("%s %s - Skipped (Not newer, modified %s)", skipPrefix, jobLabel, modified.In(location).Format(time.RFC3339)))
+			return JobResult{Status: StatusSkipped, NotNewer: true}
+		case newerThanUpToDate:
+			refreshing = false
+		case newerThanDownload:
+			refreshing = fileExists(fullPath)
+		}
+	}
+	fifo := isFIFO(fullPath)
+	if fileExists(fullPath) && !refreshing && !fifo {
 		bar.Total = 1
 		bar.Increment()
-		_, _ = bar.Stop()
+		finishBar(bar, fmt.Sprintf("%s %s - Skipped (Exists)", skipPrefix, jobLabel))
 
-		mu.Lock()
-		*skip++
-		mu.Unlock()
-		return
+		return JobResult{Status: StatusSkipped}
+	}
+	if refreshing && skipByETag && !fifo {
+		bar.UpdateTitle(fmt.Sprintf("%s %s ... Checking ETag", pterm.LightBlue("LOADING"), jobLabel))
+		if unchangedByETag(job) {
+			bar.Total = 1
+			bar.Increment()
+			finishBar(bar, fmt.Sprintf("%s %s - Skipped (Unchanged, ETag matches)", skipPrefix, jobLabel))
+			return JobResult{Status: StatusSkipped}
+		}
+	}
+
+	var written int64
+	var header http.Header
+	var err error
+	retries := 0
+	bundled := false
+	if !fifo {
+		written, bundled = runBundles.Take(job, jobLabel)
+	}
+	for !bundled {
+		written, header, err = fetchAndDownload(job, jobLabel)
+		// The reader of a pipe has already consumed what was streamed, so
+		// starting over would hand it the beginning of the file twice.
+		if err == nil || fifo || retries >= maxRetriesPerFile || !isRetryable(err) {
+			break
+		}
+		if !runRetries.Take() {
+			err = fmt.Errorf("%w (retry budget exhausted)", err)
+			break
+		}
+		retries++
+		bar.UpdateTitle(fmt.Sprintf("%s %s ... Retry %d/%d after: %v", pterm.LightBlue("LOADING"), jobLabel, retries, maxRetriesPerFile, err))
+		time.Sleep(retryDelay(retries))
+	}
+
+	if err != nil && touchMissing && errors.Is(err, errFileNotFound) {
+		if markErr := touchMissingMarker(fullPath); markErr != nil {
+			err = fmt.Errorf("%w (writing marker: %v)", err, markErr)
+		} else {
+			finishBar(bar, fmt.Sprintf("%s %s - Missing on server (marker written)", skipPrefix, jobLabel))
+			return JobResult{Status: StatusMissing, Err: err, Retries: retries}
+		}
+	}
+	if err != nil {
+		failBar(bar, fmt.Sprintf("%s %s - Failed: %v", errPrefix, jobLabel, err))
+		return JobResult{Status: StatusFailed, Err: err, Retries: retries}
+	}
+
+	// The file exists now, so a marker from an earlier run is stale.
+	_ = os.Remove(fullPath + missingMarkerSuffix)
+
+	bar.Current = bar.Total
+
+	if fifo {
+		runManifest.Record(job, written, header)
+		finishBar(bar, fmt.Sprintf("%s %s - Streamed to pipe (%s)", okPrefix, jobLabel, formatSize(written)))
+		return JobResult{Status: StatusSuccess, Bytes: written, Retries: retries}
+	}
+
+	// A file this small is usually just headers with no rows, which points
+	// at a problem with the day's data rather than the download.
+	small := minFileSize > 0 && written < minFileSize
+	if !small || !dropSmall {
+		if err := runIngest.Ingest(job); err != nil {
+			// Left on disk, the file would be skipped as existing by the
+			// retry and later runs, and its rows would never be loaded.
+			if rmErr := os.Remove(fullPath); rmErr != nil && !os.IsNotExist(rmErr) {
+				err = fmt.Errorf("%w (removing file: %v)", err, rmErr)
+			}
+			failBar(bar, fmt.Sprintf("%s %s - Failed to ingest: %v", errPrefix, jobLabel, err))
+			return JobResult{Status: StatusFailed, Bytes: written, Small: small, Err: err, Retries: retries}
+		}
+	}
+	if small {
+		if dropSmall {
+			if err := os.Remove(fullPath); err != nil {
+				failBar(bar, fmt.Sprintf("%s %s - Failed to drop small file: %v", errPrefix, jobLabel, err))
+				return JobResult{Status: StatusFailed, Bytes: written, Small: true, Err: err}
+			}
+			finishBar(bar, fmt.Sprintf("%s %s - Dropped (Suspiciously Small, %d bytes)", skipPrefix, jobLabel, written))
+		} else {
+			runManifest.Record(job, written, header)
+			finishBar(bar, fmt.Sprintf("%s %s - Saved, Suspiciously Small (%d bytes)", skipPrefix, jobLabel, written))
+		}
+		return JobResult{Status: StatusSuccess, Bytes: written, Small: true, Refreshed: refreshing, Retries: retries}
+	}
+
+	runManifest.Record(job, written, header)
+	verb := "Saved"
+	switch {
+	case bundled:
+		verb = "Extracted from bundle"
+	case refreshing:
+		verb = "Refreshed"
+	}
+	sizeStr := pterm.Gray(fmt.Sprintf("(%.2f MB)", float64(written)/1024/1024))
+	successMsg := fmt.Sprintf("%s %s - %s %s", okPrefix, jobLabel, verb, sizeStr)
+	finishBar(bar, successMsg)
+	return JobResult{Status: StatusSuccess, Bytes: written, Refreshed: refreshing, Retries: retries}
+}
+
+// fetchAndDownload makes one attempt at a job: it fetches a download link and
+// streams the file to disk. It returns the headers the file was served with.
+func fetchAndDownload(job Job, jobLabel string) (int64, http.Header, error) {
+	simulated := runSimulation.fail()
+	if simulated && !runSimulation.Download {
+		return 0, nil, errSimulatedFailure
 	}
 
+	bar := job.Bar
 	bar.UpdateTitle(fmt.Sprintf("%s %s ... Fetching", pterm.LightBlue("LOADING"), jobLabel))
-	dlURL, size, err := fetchDownloadLink(apiKey, relPath)
+	dlURL, size, err := cachedDownloadLink(job.RelPath)
 	if err != nil {
-		bar.UpdateTitle(fmt.Sprintf("%s %s - Error: %v", errPrefix, jobLabel, err))
-		_, _ = bar.Stop()
-		mu.Lock()
-		*fail++
-		mu.Unlock()
-		return
+		return 0, nil, explainFileLimit(err)
 	}
 
+	bar.Current = 0
 	bar.UpdateTitle(fmt.Sprintf("%s %s", pterm.LightBlue("LOADING"), jobLabel))
-	bar.Total = int(size)
+	setBarTotal(bar, size)
+
+	written, header, err := download(dlURL, job.FullPath, size, progressBarFor(bar, size))
+
+	// Presigned links can expire between the fetch and the download on slow
+	// batches. Fetch a fresh link and retry once when that happens.
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusForbidden {
+		bar.UpdateTitle(fmt.Sprintf("%s %s ... Link expired, refetching", pterm.LightBlue("LOADING"), jobLabel))
+		dlURL, size, err = fetchDownloadLink(apiKey, job.RelPath)
+		if err == nil {
+			runLinkCache.Put(job.RelPath, dlURL, size)
+			bar.Current = 0
+			setBarTotal(bar, size)
+			bar.UpdateTitle(fmt.Sprintf("%s %s", pterm.LightBlue("LOADING"), jobLabel))
+			written, header, err = download(dlURL, job.FullPath, size, progressBarFor(bar, size))
+		}
+	}
+	if err == nil && simulated {
+		err = errSimulatedFailure
+	}
+	return written, header, explainRedirect(explainFileLimit(err))
+}
+
+// configureDownloadTransport sets up the client that downloads files from the
+// CDN, capping its redirects. Go's default transport already negotiates
+// HTTP/2 over TLS, so only --http2=false needs a transport of its own, one
+// that speaks HTTP/1.1 only.
+func configureDownloadTransport() {
+	http.DefaultClient.CheckRedirect = checkRedirect
+	if useHTTP2 {
+		return
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	transport.Protocols = &protocols
+	http.DefaultClient.Transport = transport
+}
+
+// download fetches a file with --split when it applies, falling back to a
+// single stream when the server doesn't support range requests. A named pipe
+// at fullPath is streamed into as is.
+func download(url, fullPath string, size int64, bar *pterm.ProgressbarPrinter) (int64, http.Header, error) {
+	if isFIFO(fullPath) {
+		return downloadToFIFO(url, fullPath, bar)
+	}
+	if useSplit(fullPath, size) {
+		written, header, err := downloadSplit(url, fullPath, size, bar)
+		if !errors.Is(err, errRangeIgnored) {
+			return written, header, err
+		}
+	}
+	return downloadStream(url, fullPath, size, bar)
+}
+
+// isStale reports whether an existing local file is old enough to be
+// downloaded again under --refresh-older-than.
+func isStale(path string) bool {
+	if refreshOlderThan <= 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) > refreshOlderThan
+}
 
-	err = downloadStream(dlURL, fullPath, bar)
+// missingMarkerSuffix is appended to the expected path of a file the server
+// doesn't have when --touch-missing is set.
+const missingMarkerSuffix = ".missing"
 
+// touchMissingMarker writes a zero-byte marker next to where the file would
+// be, so downstream tools can tell "known missing" from "not yet downloaded".
+func touchMissingMarker(fullPath string) error {
+	if err := mkdirOutput(filepath.Dir(fullPath)); err != nil {
+		return err
+	}
+	f, err := openOutputFile(fullPath+missingMarkerSuffix, os.O_RDWR|os.O_CREATE|os.O_TRUNC, defaultFileMode)
 	if err != nil {
-		bar.UpdateTitle(fmt.Sprintf("%s %s - Failed: %v", errPrefix, jobLabel, err))
-		_, _ = bar.Stop()
-		mu.Lock()
-		*fail++
-		mu.Unlock()
-	} else {
-		sizeStr := pterm.Gray(fmt.Sprintf("(%.2f MB)", float64(size)/1024/1024))
-		successMsg := fmt.Sprintf("%s %s - Saved %s", okPrefix, jobLabel, sizeStr)
-		bar.UpdateTitle(successMsg)
-		_, _ = bar.Stop()
-		mu.Lock()
-		*success++
-		mu.Unlock()
+		return err
 	}
+	return f.Close()
 }
 
 func loadConfigRules(dType string) ([]ConfigRule, error) {
@@ -474,7 +2021,7 @@ func loadConfigRules(dType string) ([]ConfigRule, error) {
 		if err := json.Unmarshal(content, &cfg); err != nil {
 			return nil, fmt.Errorf("invalid json in %s: %v", entry.Name(), err)
 		}
-		rules = append(rules, ConfigRule{StartDate: date, Config: cfg})
+		rules = append(rules, ConfigRule{Name: entry.Name(), StartDate: date, Config: cfg})
 	}
 
 	sort.Slice(rules, func(i, j int) bool {
@@ -483,15 +2030,54 @@ func loadConfigRules(dType string) ([]ConfigRule, error) {
 	return rules, nil
 }
 
+// earliestSupportedDate returns the effective date of the oldest config, as a
+// calendar day in loc. rules must be sorted and non-empty.
+func earliestSupportedDate(rules []ConfigRule, loc *time.Location) time.Time {
+	y, m, d := rules[0].StartDate.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+var errUnknownConfigVersion = errors.New("unknown --config-version")
+
+// pinConfigVersion returns the rule named version (with or without the .json
+// extension) as the only rule, effective for every date, so all jobs are
+// resolved against that one metadata snapshot.
+func pinConfigVersion(rules []ConfigRule, version string) ([]ConfigRule, error) {
+	var names []string
+	for _, rule := range rules {
+		if rule.Name == version || strings.TrimSuffix(rule.Name, ".json") == version {
+			return []ConfigRule{{Name: rule.Name, Config: rule.Config}}, nil
+		}
+		names = append(names, rule.Name)
+	}
+	return nil, fmt.Errorf("%w %q for %s data; available versions: %s",
+		errUnknownConfigVersion, version, dataType, strings.Join(names, ", "))
+}
+
 func getConfigForDate(rules []ConfigRule, date time.Time) Config {
 	for i := len(rules) - 1; i >= 0; i-- {
-		if !date.Before(rules[i].StartDate) {
+		// Compare calendar days, since date may be in a different timezone
+		// than the UTC effective dates of the rules.
+		y, m, d := rules[i].StartDate.Date()
+		ruleStart := time.Date(y, m, d, 0, 0, 0, 0, date.Location())
+		if !date.Before(ruleStart) {
 			return rules[i].Config
 		}
 	}
 	return nil
 }
 
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// isTerminal reports whether f is attached to an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
@@ -501,21 +2087,101 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+// getRelativePath returns the path of a file as known to the server.
 func getRelativePath(exchange, pair, dType string, date time.Time) string {
+	return buildRelativePath(exchange, serverPairName(pair), dType, date, serverDateFormat)
+}
+
+// pathExchange returns the exchange of a path built by getRelativePath.
+func pathExchange(relPath string) string {
+	exchange, _, _ := strings.Cut(relPath, "/")
+	return exchange
+}
+
+// getLocalPath returns where a file is stored locally. The native layout
+// mirrors the server, while the hive layout uses key=value partition folders
+// (exchange=/pair=/date=) that SQL engines can prune on. --flatten-by
+// replaces the nested folders with a single folder per exchange, date or
+// pair; the filename alone keeps files apart within it. Either way the date
+// in the filename is rendered using --date-format. The path is built from
+// its components with filepath so it uses the platform's separator.
+func getLocalPath(exchange, pair, dType string, date time.Time) string {
+	exchange = localPathPart(exchange)
+	pair = localPathPart(localPairName(pair))
+	fileName := buildFileName(exchange, pair, dType, date, dateFormat)
+	switch flattenBy {
+	case "exchange":
+		return filepath.Join(outputDir, exchange, fileName)
+	case "date":
+		return filepath.Join(outputDir, date.Format("2006-01-02"), fileName)
+	case "pair":
+		return filepath.Join(outputDir, pair, fileName)
+	}
+	if layout == layoutHive {
+		return filepath.Join(outputDir,
+			"exchange="+exchange,
+			"pair="+pair,
+			"date="+date.Format("2006-01-02"),
+			fileName)
+	}
 	y, m, d := date.Date()
-	dateStr := date.Format("2006-01-02")
+	return filepath.Join(outputDir, exchange, dType,
+		fmt.Sprintf("%04d", y), fmt.Sprintf("%02d", m), fmt.Sprintf("%02d", d),
+		pair, fileName)
+}
 
-	var folderPart, filePart string
-	if dType == "trade" {
-		folderPart = "trade"
-		filePart = "trades"
-	} else {
-		folderPart = dType
+func buildRelativePath(exchange, pair, dType string, date time.Time, dateLayout string) string {
+	y, m, d := date.Date()
+	return fmt.Sprintf("%s/%s/%04d/%02d/%02d/%s/%s",
+		exchange, dType, y, m, d, pair, buildFileName(exchange, pair, dType, date, dateLayout))
+}
+
+func buildFileName(exchange, pair, dType string, date time.Time, dateLayout string) string {
+	filePart, ok := dataTypeFileParts[dType]
+	if !ok {
 		filePart = dType
 	}
+	return fmt.Sprintf("%s_%s_%s_%s.parquet", exchange, filePart, date.Format(dateLayout), pair)
+}
+
+func supportedDataTypes() []string {
+	types := make([]string, 0, len(dataTypeFileParts))
+	for t := range dataTypeFileParts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+var errInvalidEndOffset = errors.New("expected end-Nd with N a positive number of days")
+
+// parseEndOffset parses a --start-date of the form end-Nd, meaning N days
+// before --end-date. ok reports whether value has that form at all, so other
+// values can be parsed as dates.
+func parseEndOffset(value string) (days int, ok bool, err error) {
+	n, found := strings.CutPrefix(value, "end-")
+	if !found {
+		return 0, false, nil
+	}
+	n, found = strings.CutSuffix(n, "d")
+	days, convErr := strconv.Atoi(n)
+	if !found || convErr != nil || days <= 0 {
+		return 0, true, fmt.Errorf("%w: %q", errInvalidEndOffset, value)
+	}
+	return days, true, nil
+}
 
-	return fmt.Sprintf("%s/%s/%04d/%02d/%02d/%s/%s_%s_%s_%s.parquet",
-		exchange, folderPart, y, m, d, pair, exchange, filePart, dateStr, pair)
+// validateDateFormat checks that a layout renders to a non-empty string that
+// is safe to use inside a filename.
+func validateDateFormat(layout string) error {
+	sample := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).Format(layout)
+	if strings.TrimSpace(sample) == "" {
+		return errors.New("layout renders an empty string")
+	}
+	if strings.ContainsAny(sample, `/\:*?"<>|`) {
+		return fmt.Errorf("layout %q renders %q, which contains characters not allowed in filenames", layout, sample)
+	}
+	return nil
 }
 
 type APIResponse struct {
@@ -526,82 +2192,337 @@ type APIResponse struct {
 	Message     string `json:"message"`
 }
 
-func fetchDownloadLink(apiKey, relPath string) (string, int64, error) {
-	baseURL := "https://7879w58k4l.execute-api.eu-west-1.amazonaws.com/dev/"
-	req, err := http.NewRequest("GET", baseURL, nil)
+var errFileNotFound = errors.New("file not found on server")
+
+const defaultAPIURL = "https://7879w58k4l.execute-api.eu-west-1.amazonaws.com/dev/"
+
+var errInvalidAPIParam = errors.New("invalid --api-param")
+
+// parseAPIParams parses repeated key=value flags into query parameters. The
+// file parameter is reserved for the requested path.
+func parseAPIParams(params []string) (url.Values, error) {
+	values := url.Values{}
+	for _, p := range params {
+		key, value, ok := strings.Cut(p, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w %q: expected key=value", errInvalidAPIParam, p)
+		}
+		if key == "file" {
+			return nil, fmt.Errorf("%w %q: the file parameter is set by the tool", errInvalidAPIParam, p)
+		}
+		values.Add(key, value)
+	}
+	return values, nil
+}
+
+// newLinkRequest builds the request that asks the API for a download link.
+func newLinkRequest(apiKey, relPath string) (*http.Request, error) {
+	endpoint, apiKey := linkEndpoint(relPath, apiKey)
+	return newLinkRequestTo(endpoint, apiKey, relPath)
+}
+
+// newLinkRequestTo builds the link request for relPath against endpoint.
+func newLinkRequestTo(endpoint, apiKey, relPath string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
-		return "", 0, err
+		return nil, err
 	}
 
 	q := req.URL.Query()
+	for key, values := range extraAPIParams {
+		for _, v := range values {
+			q.Add(key, v)
+		}
+	}
 	q.Add("file", relPath)
-	req.URL.RawQuery = q.Encode()
+	req.URL.RawQuery = encodeQuery(q)
 
 	if apiKey != "" {
 		req.Header.Set("x-Api-Key", apiKey)
 	}
+	return req, nil
+}
+
+// encodeQuery encodes q like url.Values.Encode, but writes spaces as %20
+// rather than '+', which not every server decodes as a space. A literal '+'
+// is escaped as %2B, so every '+' left in the output is a space.
+func encodeQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// fetchDownloadLink asks the API for the download link of relPath, failing
+// over to the --api-url-mirrors if the gateway is down, and retrying once
+// with a fresh key from --api-key-cmd if the key is rejected.
+func fetchDownloadLink(apiKey, relPath string) (string, int64, error) {
+	return withReauth(apiKey, relPath, func(key string) (string, int64, error) {
+		endpoint, key := linkEndpoint(relPath, key)
+		return runMirrors.Fetch(endpoint, relPath, func(endpoint string) (string, int64, error) {
+			req, err := newLinkRequestTo(endpoint, key, relPath)
+			if err != nil {
+				return "", 0, err
+			}
+
+			runRateLimits.Wait(pathExchange(relPath))
+			start := time.Now()
+			dlURL, size, status, err := requestDownloadLink(req)
+			runAudit.LinkFetch(req.URL.String(), start, status, dlURL, size, err)
+			return dlURL, size, err
+		})
+	})
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+// requestDownloadLink sends a link request and decodes the response. It also
+// returns the HTTP status (0 if no response arrived).
+func requestDownloadLink(req *http.Request) (string, int64, int, error) {
+	client := &http.Client{Timeout: 10 * time.Second, CheckRedirect: checkRedirect}
+	resp, err := client.Do(runHTTPDebug.Trace(req))
 	if err != nil {
-		return "", 0, err
+		return "", 0, 0, err
 	}
-	defer resp.Body.Close()
+	defer func() {
+		// The decoder stops before the trailing newline; a body closed before
+		// EOF takes its connection out of the pool.
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+	}()
 
 	if resp.StatusCode != 200 {
 		var apiErr APIResponse
 		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
-		if apiErr.Message != "" {
-			return "", 0, errors.New(apiErr.Message)
-		}
 		if resp.StatusCode == 404 {
-			return "", 0, errors.New("file not found on server")
+			if apiErr.Message != "" {
+				return "", 0, resp.StatusCode, fmt.Errorf("%w: %s", errFileNotFound, apiErr.Message)
+			}
+			return "", 0, resp.StatusCode, errFileNotFound
 		}
-		return "", 0, fmt.Errorf("api status %d", resp.StatusCode)
+		return "", 0, resp.StatusCode, &APIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
 	}
 
 	var successResp APIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&successResp); err != nil {
-		return "", 0, fmt.Errorf("invalid json: %v", err)
+		return "", 0, resp.StatusCode, fmt.Errorf("invalid json: %v", err)
+	}
+
+	return successResp.DownloadURL, successResp.FileSize, resp.StatusCode, nil
+}
+
+// setBarTotal sizes the bar for a download. An unknown size (0) would render
+// a broken bar, so it gets a placeholder total until the download completes.
+func setBarTotal(bar *pterm.ProgressbarPrinter, size int64) {
+	if size <= 0 {
+		bar.Total = 1
+		return
 	}
+	bar.Total = int(size)
+}
 
-	return successResp.DownloadURL, successResp.FileSize, nil
+// progressBarFor returns the bar that should track a download of the given
+// size, or nil when the file is known to be below --progress-threshold and
+// live progress would only cause flicker.
+func progressBarFor(bar *pterm.ProgressbarPrinter, size int64) *pterm.ProgressbarPrinter {
+	if size > 0 && size < progressThreshold {
+		return nil
+	}
+	return bar
 }
 
-func downloadStream(url, fullPath string, bar *pterm.ProgressbarPrinter) error {
-	resp, err := http.Get(url)
+var (
+	errUnexpectedPartialContent = errors.New("server sent partial content (206) for a full download")
+	errSizeMismatch             = errors.New("incomplete download")
+)
+
+// downloadStream writes the file at url to fullPath and returns its size and
+// the response headers.
+// When expectedSize is known (> 0) the size must match it. A failed download
+// never leaves a partial file behind, since that would be skipped as
+// "existing" on the next run: the data goes to a .part file that is synced
+// and renamed into place once complete, unless --no-atomic is set. Under
+// --resume the .part file is kept on failure and continued by the next
+// attempt, and its progress is recorded in the checkpoint so a batch
+// interrupted mid-file can continue it too.
+func downloadStream(url, fullPath string, expectedSize int64, bar *pterm.ProgressbarPrinter) (total int64, header http.Header, err error) {
+	target := downloadTarget(fullPath)
+	var offset int64
+	if resume {
+		offset = resumeOffset(url, fullPath, expectedSize)
+	}
+
+	byteRange := ""
+	if offset > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-", offset)
+	}
+	start := time.Now()
+	status := 0
+	defer func() {
+		runAudit.Download("download", url, byteRange, start, status, max(total-offset, 0), err)
+	}()
+
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return 0, nil, err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	} else {
+		// Accepting gzip explicitly turns off the transport's transparent
+		// decompression, so the progress bar sees the bytes on the wire.
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	resp, err := http.DefaultClient.Do(runHTTPDebug.Trace(req))
+	if err != nil {
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
+	status = resp.StatusCode
+	gzipped := isGzipEncoded(resp.Header)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Either a fresh download, or the server ignored our Range header
+		// and is sending the whole file again.
+		offset = 0
+	case http.StatusPartialContent:
+		if offset == 0 {
+			// We sent no Range header, so a 206 means a misconfigured CDN
+			// is serving only part of the file.
+			return 0, nil, errUnexpectedPartialContent
+		}
+	default:
+		return 0, nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+	if gzipped && offset > 0 {
+		return 0, nil, errCompressedRange
+	}
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("status %d", resp.StatusCode)
+	if err := mkdirOutput(filepath.Dir(target)); err != nil {
+		return 0, nil, err
+	}
+	acquireOpenFile()
+	defer releaseOpenFile()
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := openOutputFile(target, flags, defaultFileMode)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-		return err
+	// Fall back to the CDN's Content-Length when the API didn't report a
+	// size, and to a spinner when neither is known.
+	// A gzip-encoded body is tracked by its compressed length.
+	unknownSize := false
+	if bar != nil {
+		switch {
+		case gzipped && resp.ContentLength > 0:
+			bar.Total = int(resp.ContentLength)
+		case gzipped || expectedSize <= 0 && resp.ContentLength <= 0:
+			unknownSize = true
+		case expectedSize <= 0:
+			bar.Total = int(offset + resp.ContentLength)
+		}
+		bar.Current = int(offset)
 	}
-	file, err := os.Create(fullPath)
+	proxyReader := &ProgressReader{Reader: resp.Body, Bar: bar, UnknownSize: unknownSize}
+	body, err := decodeBody(proxyReader, resp.Header)
 	if err != nil {
-		return err
+		_ = file.Close()
+		_ = os.Remove(target)
+		return 0, resp.Header, err
+	}
+	// offsetRecorder doesn't expose *os.File's ReadFrom, so io.CopyBuffer
+	// actually uses our buffer instead of falling back to its own.
+	writer := &offsetRecorder{file: file, path: fullPath, offset: offset, lastSync: time.Now()}
+	written, err := io.CopyBuffer(writer, body, make([]byte, bufferSize))
+	total = offset + written
+	if err == nil {
+		// The Content-Length of a gzip-encoded body is the compressed size.
+		expected := expectedSize
+		if expected <= 0 && resp.ContentLength > 0 && !gzipped {
+			expected = offset + resp.ContentLength
+		}
+		if expected > 0 && total != expected {
+			err = fmt.Errorf("%w: got %d of %d bytes", errSizeMismatch, total, expected)
+		}
+	}
+	if err == nil {
+		err = syncForRename(file)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && target != fullPath {
+		err = os.Rename(target, fullPath)
+	}
+	if err != nil && (!resume || (expectedSize > 0 && total > expectedSize)) {
+		_ = os.Remove(target)
+	}
+	return total, resp.Header, err
+}
+
+// APIError is returned when the link API responds with an error status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return e.Message
 	}
-	defer file.Close()
+	return fmt.Sprintf("api status %d", e.StatusCode)
+}
 
-	proxyReader := &ProgressReader{Reader: resp.Body, Bar: bar}
-	_, err = io.Copy(file, proxyReader)
-	return err
+// StatusError is returned when the download server responds with an
+// unexpected HTTP status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d", e.StatusCode)
 }
 
 type ProgressReader struct {
 	Reader io.Reader
 	Bar    *pterm.ProgressbarPrinter
+
+	// UnknownSize switches the bar to spinner mode: instead of advancing a
+	// percentage, the title shows a spinner and the bytes received so far.
+	UnknownSize bool
+
+	title      string
+	read       int64
+	frame      int
+	lastUpdate time.Time
 }
 
 func (pr *ProgressReader) Read(p []byte) (int, error) {
 	n, err := pr.Reader.Read(p)
+	receivedBytes.Add(int64(n))
 	if n > 0 && pr.Bar != nil {
-		pr.Bar.Add(n)
+		if pr.UnknownSize {
+			pr.spin(n)
+		} else {
+			pr.Bar.Add(n)
+		}
 	}
 	return n, err
 }
+
+func (pr *ProgressReader) spin(n int) {
+	if pr.title == "" {
+		pr.title = pr.Bar.Title
+	}
+	pr.read += int64(n)
+	if time.Since(pr.lastUpdate) < 100*time.Millisecond {
+		return
+	}
+	pr.lastUpdate = time.Now()
+
+	seq := pterm.DefaultSpinner.Sequence
+	pr.frame = (pr.frame + 1) % len(seq)
+	pr.Bar.UpdateTitle(fmt.Sprintf("%s %s %s", pr.title, seq[pr.frame],
+		pterm.Gray(fmt.Sprintf("%.2f MB", float64(pr.read)/1024/1024))))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestEncodeQuery(t *testing.T) {
+	tests := []struct {
+		file, want string
+	}{
+		{"binance/trade/2025/01/01/btc_usdt/x.parquet", "file=binance%2Ftrade%2F2025%2F01%2F01%2Fbtc_usdt%2Fx.parquet"},
+		{"btc usdt", "file=btc%20usdt"},
+		{"btc+usdt", "file=btc%2Busdt"},
+		{"100%_usdt", "file=100%25_usdt"},
+		{"perp:xyz:aapl_usd", "file=perp%3Axyz%3Aaapl_usd"},
+		{"ünï_cödé", "file=%C3%BCn%C3%AF_c%C3%B6d%C3%A9"},
+		{"a b+c%d", "file=a%20b%2Bc%25d"},
+	}
+	for _, tt := range tests {
+		got := encodeQuery(url.Values{"file": {tt.file}})
+		if got != tt.want {
+			t.Errorf("encodeQuery(file=%q) = %q, want %q", tt.file, got, tt.want)
+		}
+		decoded, err := url.ParseQuery(got)
+		if err != nil || decoded.Get("file") != tt.file {
+			t.Errorf("%q decodes to %q (%v), want %q", got, decoded.Get("file"), err, tt.file)
+		}
+	}
+}
+
+func TestNewLinkRequestToEncodesPath(t *testing.T) {
+	saved := extraAPIParams
+	extraAPIParams = url.Values{"tier": {"pro plus"}}
+	t.Cleanup(func() { extraAPIParams = saved })
+	relPath := "binance/trade/2025/01/01/btc+usdt 1%/binance_trades_2025-01-01_btc+usdt 1%.parquet"
+
+	req, err := newLinkRequestTo("https://api.example.com/dev/link", "key", relPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "file=binance%2Ftrade%2F2025%2F01%2F01%2Fbtc%2Busdt%201%25%2Fbinance_trades_2025-01-01_btc%2Busdt%201%25.parquet&tier=pro%20plus"; req.URL.RawQuery != want {
+		t.Errorf("query = %q, want %q", req.URL.RawQuery, want)
+	}
+	if got := req.URL.Query().Get("file"); got != relPath {
+		t.Errorf("file decodes to %q, want %q", got, relPath)
+	}
+	if got := req.Header.Get("x-Api-Key"); got != "key" {
+		t.Errorf("API key header = %q, want key", got)
+	}
+}
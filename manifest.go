@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// manifestEntry describes one downloaded file. The header fields are only
+// filled with --include-headers-in-manifest, except the ETag, which
+// --skip-by-etag records as well.
+type manifestEntry struct {
+	Type         string    `json:"type"`
+	Exchange     string    `json:"exchange"`
+	Pair         string    `json:"pair"`
+	Date         string    `json:"date"`
+	ServerPath   string    `json:"server_path"`
+	Size         int64     `json:"size"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+}
+
+// Manifest records every file downloaded into the output directory, keyed by
+// local path (--manifest). Entries from earlier runs are kept, so the file
+// describes the whole dataset rather than the last batch. A nil *Manifest is
+// valid and records nothing.
+type Manifest struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]manifestEntry
+}
+
+// runManifest is the --manifest of the current invocation.
+var runManifest *Manifest
+
+// loadManifest reads the manifest at path. A missing file yields an empty
+// manifest.
+func loadManifest(path string) (*Manifest, error) {
+	m := &Manifest{path: path, entries: make(map[string]manifestEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.entries); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Record adds a freshly downloaded file, replacing any earlier entry for it.
+// header is the response the file was served with; it may be nil.
+func (m *Manifest) Record(job Job, size int64, header http.Header) {
+	if m == nil {
+		return
+	}
+	entry := manifestEntry{
+		Type:         dataType,
+		Exchange:     job.Exchange,
+		Pair:         job.Pair,
+		Date:         job.Date.Format(serverDateFormat),
+		ServerPath:   job.RelPath,
+		Size:         size,
+		DownloadedAt: time.Now().UTC(),
+	}
+	if (includeHeaders || skipByETag) && header != nil {
+		entry.ETag = header.Get("ETag")
+	}
+	if includeHeaders && header != nil {
+		entry.LastModified = header.Get("Last-Modified")
+		entry.ContentType = header.Get("Content-Type")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[job.FullPath] = entry
+}
+
+// Entry returns the entry of the file at fullPath, if any.
+func (m *Manifest) Entry(fullPath string) (manifestEntry, bool) {
+	if m == nil {
+		return manifestEntry{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[fullPath]
+	return entry, ok
+}
+
+// Repaired updates the size and download time of a file downloaded again by
+// the repair command. Files the manifest doesn't list are left out of it,
+// since their type, exchange, pair and date aren't known.
+func (m *Manifest) Repaired(fullPath string, size int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[fullPath]
+	if !ok {
+		return
+	}
+	entry.Size = size
+	entry.DownloadedAt = time.Now().UTC()
+	m.entries[fullPath] = entry
+}
+
+// Save writes the manifest back to its file, replacing it atomically.
+func (m *Manifest) Save() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m.entries); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// saveManifest saves the --manifest after a batch, warning on failure.
+func saveManifest() {
+	if err := runManifest.Save(); err != nil {
+		pterm.Warning.Printf("Failed to save manifest: %v\n", err)
+	}
+}
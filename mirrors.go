@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+var errInvalidMirror = errors.New("invalid --api-url-mirrors entry")
+
+// Mirror cooldowns: a mirror that just failed is tried last for
+// mirrorCooldown, doubling with every further failure up to
+// maxMirrorCooldown, after which it is preferred again in its configured
+// order.
+const (
+	mirrorCooldown    = 10 * time.Second
+	maxMirrorCooldown = 5 * time.Minute
+)
+
+// Mirrors fails link requests over from --api-url to the --api-url-mirrors
+// when a gateway is down. Each request tries the mirrors that are healthy in
+// their configured order, then those still cooling down after a failure. A
+// nil *Mirrors uses the single API URL.
+type Mirrors struct {
+	mu     sync.Mutex
+	urls   []string // --api-url first
+	health []mirrorHealth
+}
+
+type mirrorHealth struct {
+	failures  int       // Consecutive failures
+	downUntil time.Time // Tried last until then
+	served    int
+	failed    int
+}
+
+// runMirrors is the mirror list of the current invocation, nil without
+// --api-url-mirrors.
+var runMirrors *Mirrors
+
+// newMirrors validates the mirrors and puts primary in front of them.
+func newMirrors(primary string, mirrors []string) (*Mirrors, error) {
+	m := &Mirrors{urls: []string{primary}}
+	for _, mirror := range trimAll(mirrors) {
+		u, err := url.Parse(mirror)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w %q: expected an http:// or https:// URL", errInvalidMirror, mirror)
+		}
+		if slices.Contains(m.urls, mirror) {
+			return nil, fmt.Errorf("%w %q: listed twice", errInvalidMirror, mirror)
+		}
+		m.urls = append(m.urls, mirror)
+	}
+	m.health = make([]mirrorHealth, len(m.urls))
+	return m, nil
+}
+
+// Fetch runs request against endpoint, failing over to the other mirrors if
+// the gateway is unreachable or returns a server error. Answers such as 404
+// or a rejected key are the same on every mirror and are returned as they
+// are. An endpoint other than --api-url, set for an exchange in the config
+// file, has no mirrors.
+func (m *Mirrors) Fetch(endpoint, relPath string, request func(endpoint string) (string, int64, error)) (string, int64, error) {
+	if m == nil || endpoint != m.urls[0] {
+		return request(endpoint)
+	}
+	var link string
+	var size int64
+	var err error
+	order := m.order()
+	for _, i := range order {
+		link, size, err = request(m.urls[i])
+		outage := err != nil && isOutage(err)
+		m.record(i, outage)
+		runHTTPDebug.Mirror(m.urls[i], relPath, err)
+		if !outage {
+			return link, size, err
+		}
+	}
+	return "", 0, fmt.Errorf("%w (all %d API mirrors failed)", err, len(order))
+}
+
+// order returns the mirror indexes to try: healthy ones in configured order,
+// then the others by when their cooldown ends.
+func (m *Mirrors) order() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var healthy, cooling []int
+	for i, h := range m.health {
+		if h.downUntil.After(now) {
+			cooling = append(cooling, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	slices.SortStableFunc(cooling, func(a, b int) int { return m.health[a].downUntil.Compare(m.health[b].downUntil) })
+	return append(healthy, cooling...)
+}
+
+func (m *Mirrors) record(i int, outage bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := &m.health[i]
+	if !outage {
+		h.failures = 0
+		h.downUntil = time.Time{}
+		h.served++
+		return
+	}
+	h.failures++
+	h.failed++
+	h.downUntil = time.Now().Add(min(mirrorCooldown<<min(h.failures-1, 10), maxMirrorCooldown))
+}
+
+// isOutage reports whether err means the gateway itself is unavailable.
+func isOutage(err error) bool {
+	switch classifyError(err) {
+	case categoryDNS, categoryConnection, categoryTimeout, categoryServer:
+		return true
+	}
+	return false
+}
+
+// Report prints how many link requests each mirror served and failed, if
+// any of them failed during the run.
+func (m *Mirrors) Report() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.ContainsFunc(m.health, func(h mirrorHealth) bool { return h.failed > 0 }) {
+		return
+	}
+	tableData := [][]string{{"API mirror", "Served", "Failed"}}
+	for i, h := range m.health {
+		tableData = append(tableData, []string{m.urls[i], fmt.Sprint(h.served), fmt.Sprint(h.failed)})
+	}
+	pterm.Println()
+	pterm.Warning.Println("Some API mirrors failed during the run:")
+	renderTable(pterm.DefaultTable.WithHasHeader().WithData(tableData))
+}
+
+// Mirror logs which mirror a link request for relPath went to and, if it
+// failed, why.
+func (l *HTTPDebugLog) Mirror(endpoint, relPath string, err error) {
+	if l == nil {
+		return
+	}
+	host := endpoint
+	if u, parseErr := url.Parse(endpoint); parseErr == nil {
+		host = u.Host
+	}
+	line := fmt.Sprintf("%s MIRROR %s file=%s", time.Now().UTC().Format(time.RFC3339Nano), host, relPath)
+	if urlErr := (*url.Error)(nil); errors.As(err, &urlErr) {
+		err = urlErr.Err // Without the URL and its query string
+	}
+	if err != nil {
+		line += fmt.Sprintf(" error=%q", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = fmt.Fprintln(l.file, line)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// openFiles bounds how many output files are open at once (--max-open-files),
+// separately from --parallel. A nil channel means no bound.
+var openFiles chan struct{}
+
+// acquireOpenFile waits for a free slot before an output file is opened.
+func acquireOpenFile() {
+	if openFiles != nil {
+		openFiles <- struct{}{}
+	}
+}
+
+// releaseOpenFile frees the slot once the output file is closed.
+func releaseOpenFile() {
+	if openFiles != nil {
+		<-openFiles
+	}
+}
+
+// isFileLimit reports whether err comes from running out of file
+// descriptors, for this process (EMFILE) or the whole system (ENFILE).
+func isFileLimit(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// explainFileLimit adds a hint to the otherwise cryptic "too many open files"
+// error. Every download holds a socket per connection as well as its output
+// file, so high --parallel and --split values can exhaust a default limit.
+func explainFileLimit(err error) error {
+	if !isFileLimit(err) {
+		return err
+	}
+	return fmt.Errorf("%w (raise the limit with ulimit -n, or lower --parallel, --split or --max-open-files)", err)
+}
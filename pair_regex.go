@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// PairRegex selects the pairs of the requested exchanges by pattern
+// (--pair-include-regex, --pair-exclude-regex): those matching the include
+// pattern, or every pair if there is none, minus those matching the exclude
+// pattern. Patterns are unanchored; use ^ and $ to match whole pairs.
+type PairRegex struct {
+	include *regexp.Regexp // nil includes every pair
+	exclude *regexp.Regexp // nil excludes none
+}
+
+// runPairRegex is the pair selection of the current invocation, nil if
+// neither flag is given.
+var runPairRegex *PairRegex
+
+func parsePairRegex(include, exclude string) (*PairRegex, error) {
+	p := &PairRegex{}
+	var err error
+	if include != "" {
+		if p.include, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("invalid --pair-include-regex: %w", err)
+		}
+	}
+	if exclude != "" {
+		if p.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid --pair-exclude-regex: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Match reports whether pair is selected.
+func (p *PairRegex) Match(pair string) bool {
+	return (p.include == nil || p.include.MatchString(pair)) && (p.exclude == nil || !p.exclude.MatchString(pair))
+}
+
+func (p *PairRegex) String() string {
+	var parts []string
+	if p.include != nil {
+		parts = append(parts, fmt.Sprintf("include %q", p.include))
+	}
+	if p.exclude != nil {
+		parts = append(parts, fmt.Sprintf("exclude %q", p.exclude))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// reportPairRegex lists the pairs the patterns resolve to on each requested
+// exchange between start and end, and exits if there are none.
+func reportPairRegex(start, end time.Time, configRules []ConfigRule) {
+	selected := make(map[string]map[string]bool)
+	for curr := start; !curr.After(end); curr = curr.AddDate(0, 0, 1) {
+		config := getConfigForDate(configRules, curr)
+		for _, ex := range trimAll(exchanges) {
+			for _, pair := range config[ex] {
+				if !runPairRegex.Match(pair) {
+					continue
+				}
+				if selected[ex] == nil {
+					selected[ex] = make(map[string]bool)
+				}
+				selected[ex][pair] = true
+			}
+		}
+	}
+	if len(selected) == 0 {
+		pterm.Error.Printf("Pair patterns (%s) match no pairs of %s between %s and %s\n",
+			runPairRegex, strings.Join(trimAll(exchanges), ", "), start.Format("2006-01-02"), end.Format("2006-01-02"))
+		os.Exit(1)
+	}
+
+	count := 0
+	for _, pairs := range selected {
+		count += len(pairs)
+	}
+	pterm.Info.Printf("Pair patterns (%s) select %d pairs on %d exchanges:\n", runPairRegex, count, len(selected))
+	for _, ex := range slices.Sorted(maps.Keys(selected)) {
+		pterm.Info.Printf("  %s: %s\n", ex, strings.Join(slices.Sorted(maps.Keys(selected[ex])), ", "))
+	}
+}
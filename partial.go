@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// partSuffix is appended to the output path while a file is downloaded, so
+// an interrupted download never looks finished and, with --resume, can be
+// continued with a range request.
+const partSuffix = ".part"
+
+// verifyChunkSize is how many bytes at each end of a partial file are
+// compared against the server by --verify-resume.
+const verifyChunkSize = 4096
+
+var errRangeIgnored = errors.New("server ignored the range request")
+
+// downloadTarget returns the path a download of fullPath is written to: its
+// .part file, or fullPath itself with --no-atomic.
+func downloadTarget(fullPath string) string {
+	if noAtomic {
+		return fullPath
+	}
+	return fullPath + partSuffix
+}
+
+// syncForRename flushes a completed .part file to disk before it is renamed
+// into place. Otherwise a crash shortly after the rename can leave a file
+// under its final name whose data never reached the disk. Nothing is renamed
+// with --no-atomic, so there is nothing to guard.
+func syncForRename(file *os.File) error {
+	if noAtomic {
+		return nil
+	}
+	return file.Sync()
+}
+
+// resumeOffset returns how many bytes of the .part file of fullPath can be
+// kept when resuming a download of expectedSize bytes. If the checkpoint
+// recorded an offset for it, anything past that offset may not have reached
+// the disk intact and is cut off. A partial that is too large, or that no
+// longer matches the server with --verify-resume, is discarded.
+func resumeOffset(url, fullPath string, expectedSize int64) int64 {
+	partPath := fullPath + partSuffix
+	info, err := os.Stat(partPath)
+	if err != nil || info.Size() == 0 {
+		return 0
+	}
+	size := info.Size()
+
+	if recorded, ok := resumeState.Offsets[fullPath]; ok && recorded < size {
+		if err := os.Truncate(partPath, recorded); err != nil {
+			_ = os.Remove(partPath)
+			return 0
+		}
+		size = recorded
+	}
+
+	// A partial as large as the whole file can't be continued with a range
+	// request, and one larger than it is certainly stale.
+	if expectedSize > 0 && size >= expectedSize {
+		_ = os.Remove(partPath)
+		return 0
+	}
+
+	if verifyResume {
+		if ok, err := partialMatches(url, partPath, size); err != nil || !ok {
+			_ = os.Remove(partPath)
+			return 0
+		}
+	}
+	return size
+}
+
+// partialMatches compares the first and last bytes of the partial file with
+// the same ranges fetched fresh from url. A file re-published with different
+// content since the partial was written would otherwise be silently spliced
+// together from two versions.
+func partialMatches(url, partPath string, size int64) (bool, error) {
+	n := min(size, verifyChunkSize)
+
+	f, err := os.Open(partPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	for _, from := range []int64{0, size - n} {
+		local := make([]byte, n)
+		if _, err := f.ReadAt(local, from); err != nil {
+			return false, err
+		}
+		remote, err := fetchRange(url, from, from+n-1)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(local, remote) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// fetchRange downloads bytes from..to (inclusive) of the file at url.
+func fetchRange(url string, from, to int64) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to))
+
+	resp, err := http.DefaultClient.Do(runHTTPDebug.Trace(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return nil, errRangeIgnored
+	default:
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, to-from+1))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/pterm/pterm"
+)
+
+// unsafePathChars are replaced by --normalize-output, and always on Windows.
+// They are invalid in Windows filenames (derivative pairs such as
+// perp:xyz:aapl_usd contain colons), and / would add an extra directory level.
+const unsafePathChars = `<>:"/\|?*`
+
+// windowsPaths enables the sanitizing Windows needs regardless of
+// --normalize-output.
+var windowsPaths = runtime.GOOS == "windows"
+
+// windowsReservedNames are device names Windows doesn't allow as a file or
+// directory name, with or without an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+var errInvalidName = errors.New("invalid name")
+
+// validateNames checks that every exchange and pair name can be used as a
+// single segment of the server path. Empty names, as left by a trailing
+// comma, are ignored. Other special characters (such as the
+// colons in perp:xyz:aapl_usd) are fine: the path is URL-encoded in the link
+// request.
+func validateNames(exchanges, pairs []string) error {
+	for _, ex := range exchanges {
+		if ex = strings.TrimSpace(ex); ex == "" {
+			continue
+		}
+		if err := validateName(ex); err != nil {
+			return fmt.Errorf("exchange %q: %w", ex, err)
+		}
+	}
+	for _, pair := range pairs {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		if err := validateName(pair); err != nil {
+			if strings.Contains(pair, "/") {
+				return fmt.Errorf("pair %q: %w (pairs are written with an underscore, e.g. btc_usdt)", pair, err)
+			}
+			return fmt.Errorf("pair %q: %w", pair, err)
+		}
+	}
+	return nil
+}
+
+func validateName(name string) error {
+	switch {
+	case name == "." || name == "..":
+		return fmt.Errorf("%w: not a path segment", errInvalidName)
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("%w: contains a path separator", errInvalidName)
+	case strings.ContainsFunc(name, unicode.IsControl):
+		return fmt.Errorf("%w: contains a control character", errInvalidName)
+	}
+	return nil
+}
+
+var errInvalidPairDelimiter = errors.New("invalid --path-pair-delimiter")
+
+// validatePairDelimiter checks that --path-pair-delimiter can appear inside a
+// server path segment.
+func validatePairDelimiter(delim string) error {
+	switch {
+	case strings.ContainsAny(delim, `/\`):
+		return fmt.Errorf("%w: contains a path separator", errInvalidPairDelimiter)
+	case strings.ContainsFunc(delim, unicode.IsControl):
+		return fmt.Errorf("%w: contains a control character", errInvalidPairDelimiter)
+	}
+	return nil
+}
+
+// serverPairName returns pair as it appears in server paths. With
+// --path-pair-delimiter, the underscores of the input form are replaced by
+// the server's delimiter, e.g. btc_usdt becomes btc-usdt.
+func serverPairName(pair string) string {
+	if pathPairDelimiter == "" {
+		return pair
+	}
+	return strings.ReplaceAll(pair, "_", pathPairDelimiter)
+}
+
+// localPathPart returns the form of an exchange or pair name used in local
+// paths.
+func localPathPart(name string) string {
+	if normalizeOutput {
+		name = normalizePathPart(name)
+	}
+	if windowsPaths {
+		name = windowsSafePathPart(name)
+	}
+	return name
+}
+
+// normalizePathPart lowercases name and replaces filesystem-unsafe and
+// control characters with underscores.
+func normalizePathPart(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(unsafePathChars, r) {
+			return '_'
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
+
+// windowsSafePathPart makes name usable as a path component on Windows:
+// reserved characters become underscores, a trailing dot or space (which
+// Windows silently strips) is replaced, and reserved device names get an
+// underscore appended. Case is preserved.
+func windowsSafePathPart(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(unsafePathChars, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		name = name[:len(name)-1] + "_"
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if windowsReservedNames[strings.ToUpper(base)] {
+		name = base + "_" + name[len(base):]
+	}
+	return name
+}
+
+// warnNormalized reports each exchange or pair name that is changed for use in
+// local paths, once per run.
+func warnNormalized(jobs []Job) {
+	for _, job := range jobs {
+		for _, name := range []string{job.Exchange, localPairName(job.Pair)} {
+			local := localPathPart(name)
+			if local != name && !normalizedWarned[name] {
+				normalizedWarned[name] = true
+				pterm.Warning.Printf("Normalized %q to %q in local paths\n", name, local)
+			}
+		}
+	}
+}
+
+// normalizedWarned holds the names warnNormalized has already reported.
+var normalizedWarned = make(map[string]bool)
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWindowsSafePathPart(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"btc_usdt", "btc_usdt"},
+		{"CON", "CON_"},
+		{"con", "con_"},
+		{"aux.txt", "aux_.txt"},
+		{"Lpt9.tar.gz", "Lpt9_.tar.gz"},
+		{"console", "console"},
+		{"COM10", "COM10"},
+		{"perp:xyz:aapl_usd", "perp_xyz_aapl_usd"},
+		{`btc\usdt`, "btc_usdt"},
+		{"btc/usdt", "btc_usdt"},
+		{`a<b>c"d|e?f*g`, "a_b_c_d_e_f_g"},
+		{"btc\tusdt", "btc_usdt"},
+		{"usdt.", "usdt_"},
+		{"usdt ", "usdt_"},
+		{"nul.", "nul_"},
+		{"BTC_Usdt", "BTC_Usdt"},
+	}
+	for _, tt := range tests {
+		if got := windowsSafePathPart(tt.name); got != tt.want {
+			t.Errorf("windowsSafePathPart(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizePathPart(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"btc_usdt", "btc_usdt"},
+		{"BTC_USDT", "btc_usdt"},
+		{"perp:XYZ:aapl_usd", "perp_xyz_aapl_usd"},
+		{`btc\usdt`, "btc_usdt"},
+		{"btc/usdt", "btc_usdt"},
+		{"btc\x00usdt", "btc_usdt"},
+		{"ÉTH_usdt", "éth_usdt"},
+	}
+	for _, tt := range tests {
+		if got := normalizePathPart(tt.name); got != tt.want {
+			t.Errorf("normalizePathPart(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLocalPathPart(t *testing.T) {
+	savedWindows, savedNormalize := windowsPaths, normalizeOutput
+	t.Cleanup(func() { windowsPaths, normalizeOutput = savedWindows, savedNormalize })
+
+	tests := []struct {
+		name               string
+		windows, normalize bool
+		want               string
+	}{
+		{"CON", false, false, "CON"},
+		{"CON", true, false, "CON_"},
+		{"CON", false, true, "con"},
+		{"CON", true, true, "con_"},
+		{"Perp:X.", true, false, "Perp_X_"},
+		{"Perp:X.", false, true, "perp_x."},
+	}
+	for _, tt := range tests {
+		windowsPaths, normalizeOutput = tt.windows, tt.normalize
+		if got := localPathPart(tt.name); got != tt.want {
+			t.Errorf("localPathPart(%q) with windows=%v, normalize=%v = %q, want %q",
+				tt.name, tt.windows, tt.normalize, got, tt.want)
+		}
+	}
+}
+
+func TestValidateNames(t *testing.T) {
+	tests := []struct {
+		exchanges, pairs []string
+		wantErr          string
+	}{
+		{[]string{"binance"}, []string{"btc_usdt", ""}, ""},
+		{[]string{"binance"}, []string{"btc+usdt", "100%_usdt", "btc usdt", "perp:xyz:aapl_usd", "ünï_cödé"}, ""},
+		{[]string{"binance", " "}, []string{" btc_usdt "}, ""},
+		{[]string{"binance"}, []string{"btc/usdt"}, `pair "btc/usdt": invalid name: contains a path separator (pairs are written with an underscore, e.g. btc_usdt)`},
+		{[]string{"binance"}, []string{`btc\usdt`}, `pair "btc\\usdt": invalid name: contains a path separator`},
+		{[]string{"binance"}, []string{".."}, `pair "..": invalid name: not a path segment`},
+		{[]string{"binance"}, []string{"btc\x00usdt"}, `pair "btc\x00usdt": invalid name: contains a control character`},
+		{[]string{"bin/ance"}, []string{"btc_usdt"}, `exchange "bin/ance": invalid name: contains a path separator`},
+		{[]string{"."}, nil, `exchange ".": invalid name: not a path segment`},
+	}
+	for _, tt := range tests {
+		err := validateNames(tt.exchanges, tt.pairs)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("validateNames(%q, %q) = %v, want nil", tt.exchanges, tt.pairs, err)
+		case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+			t.Errorf("validateNames(%q, %q) = %v, want %s", tt.exchanges, tt.pairs, err, tt.wantErr)
+		case tt.wantErr != "" && !errors.Is(err, errInvalidName):
+			t.Errorf("validateNames(%q, %q) = %v, want an %v", tt.exchanges, tt.pairs, err, errInvalidName)
+		}
+	}
+}
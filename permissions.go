@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var errInvalidMode = errors.New("invalid mode")
+
+// outputDirMode and outputFileMode are the --dir-mode and --file-mode of
+// downloaded data, or 0 to keep the defaults.
+var (
+	outputDirMode  os.FileMode
+	outputFileMode os.FileMode
+)
+
+// defaultFileMode is the mode, less the umask, of downloaded files and
+// markers without --file-mode.
+const defaultFileMode os.FileMode = 0644
+
+// parseFileMode parses an octal permission mode such as 0775. An empty value
+// means the flag isn't set.
+func parseFileMode(flag, value string) (os.FileMode, error) {
+	if value == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode == 0 || mode > 0o777 {
+		return 0, fmt.Errorf("%w for --%s: %q (expected octal permissions such as 0775)", errInvalidMode, flag, value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// mkdirOutput creates the directory of downloaded files and any missing
+// parents. With --dir-mode, the directories it creates get exactly that mode;
+// the umask would otherwise clear bits such as group write. Existing
+// directories are left alone.
+func mkdirOutput(dir string) error {
+	if outputDirMode == 0 {
+		return os.MkdirAll(dir, 0755)
+	}
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := os.MkdirAll(dir, outputDirMode); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := os.Chmod(d, outputDirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openOutputFile opens a downloaded file like os.OpenFile, setting exactly
+// --file-mode on it when given instead of perm less the umask.
+func openOutputFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil || outputFileMode == 0 {
+		return f, err
+	}
+	if err := f.Chmod(outputFileMode); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestOpenCheckpointAppliesDirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions on Windows")
+	}
+	saved := outputDirMode
+	outputDirMode = 0o770
+	t.Cleanup(func() { outputDirMode = saved })
+	dir := filepath.Join(t.TempDir(), "downloads")
+
+	cp, err := openCheckpoint(filepath.Join(dir, checkpointFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.Close()
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o770 {
+		t.Errorf("output directory mode = %#o, want %#o", got, 0o770)
+	}
+}
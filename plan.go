@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// planVersion is the version of the plan format this build writes and reads.
+// It changes whenever a field changes meaning, so an old build never executes
+// a plan it would misread.
+const planVersion = 1
+
+// Plan is the resolved job list of a dry run, saved with --save-plan so it
+// can be reviewed and later run as-is with --execute-plan.
+type Plan struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Type      string    `json:"type"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	Estimated bool      `json:"estimated"` // Whether jobs carry --estimate results
+	Jobs      []PlanJob `json:"jobs"`
+}
+
+// PlanJob is one file of a plan. Status and Size are only set when the plan
+// was made with --estimate.
+type PlanJob struct {
+	Exchange   string `json:"exchange"`
+	Pair       string `json:"pair"`
+	Date       string `json:"date"`
+	ServerPath string `json:"server_path"`
+	LocalPath  string `json:"local_path"`
+	Status     string `json:"status,omitempty"` // "available", "exists", "missing" or "error"
+	Size       int64  `json:"size,omitempty"`
+}
+
+var errInvalidPlan = errors.New("invalid plan")
+
+// runPlan is the plan being executed with --execute-plan or
+// --replay-from-log, if any.
+var runPlan *Plan
+
+// newPlan builds the plan of jobs. estimates may be nil.
+func newPlan(jobs []Job, estimates []estimate) *Plan {
+	p := &Plan{
+		Version:   planVersion,
+		CreatedAt: time.Now().UTC(),
+		Type:      dataType,
+		StartDate: jobs[0].Date.Format(serverDateFormat),
+		EndDate:   jobs[len(jobs)-1].Date.Format(serverDateFormat),
+		Estimated: estimates != nil,
+	}
+	for i, job := range jobs {
+		pj := PlanJob{
+			Exchange:   job.Exchange,
+			Pair:       job.Pair,
+			Date:       job.Date.Format(serverDateFormat),
+			ServerPath: job.RelPath,
+			LocalPath:  job.FullPath,
+		}
+		if estimates != nil {
+			e := estimates[i]
+			switch {
+			case e.exists:
+				pj.Status = "exists"
+			case errors.Is(e.err, errFileNotFound):
+				pj.Status = "missing"
+			case e.err != nil:
+				pj.Status = "error"
+			default:
+				pj.Status = "available"
+				pj.Size = e.size
+			}
+		}
+		p.Jobs = append(p.Jobs, pj)
+	}
+	return p
+}
+
+// savePlan writes the plan to path.
+func savePlan(p *Plan, path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// loadPlan reads and validates the plan at path.
+func loadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidPlan, path, err)
+	}
+	if p.Version != planVersion {
+		return nil, fmt.Errorf("%w: %s: version %d is not supported (this build reads version %d)",
+			errInvalidPlan, path, p.Version, planVersion)
+	}
+	if _, ok := dataTypeFileParts[p.Type]; !ok {
+		return nil, fmt.Errorf("%w: %s: unknown type %q", errInvalidPlan, path, p.Type)
+	}
+	if len(p.Jobs) == 0 {
+		return nil, fmt.Errorf("%w: %s: no jobs", errInvalidPlan, path)
+	}
+	for _, pj := range p.Jobs {
+		if _, err := time.Parse(serverDateFormat, pj.Date); err != nil {
+			return nil, fmt.Errorf("%w: %s: invalid date %q", errInvalidPlan, path, pj.Date)
+		}
+		if pj.ServerPath == "" || pj.LocalPath == "" {
+			return nil, fmt.Errorf("%w: %s: job for %s %s on %s has no paths", errInvalidPlan, path, pj.Exchange, pj.Pair, pj.Date)
+		}
+	}
+	return &p, nil
+}
+
+// applyPlan fills in the type, date range, exchanges and tokens from the plan
+// so the usual validation applies to it. These can't also be given as flags:
+// the plan alone decides what is downloaded. source is the flag the plan was
+// read from.
+func applyPlan(cmd *cobra.Command, p *Plan, source string) error {
+	for _, flag := range []string{"type", "mode", "exchanges", "tokens", "filter", "pair-include-regex", "pair-exclude-regex",
+		"start-date", "end-date", "bundle", "watch", "execute-plan", "replay-from-log", "latest"} {
+		if flag != source && cmd.Flags().Changed(flag) {
+			return fmt.Errorf("--%s cannot be combined with --%s", source, flag)
+		}
+	}
+	dataType = p.Type
+	mode = "day"
+	startDate, endDate = p.StartDate, p.EndDate
+	exchanges, tokens = nil, nil
+	for _, pj := range p.Jobs {
+		if !slices.Contains(exchanges, pj.Exchange) {
+			exchanges = append(exchanges, pj.Exchange)
+		}
+		if !slices.Contains(tokens, pj.Pair) {
+			tokens = append(tokens, pj.Pair)
+		}
+	}
+	return nil
+}
+
+// jobs returns the plan's jobs with exactly the server and local paths it
+// was saved with, whatever the current layout flags say.
+func (p *Plan) jobs() []Job {
+	jobs := make([]Job, len(p.Jobs))
+	for i, pj := range p.Jobs {
+		date, _ := time.ParseInLocation(serverDateFormat, pj.Date, location)
+		jobs[i] = Job{
+			Index:    i + 1,
+			Total:    len(p.Jobs),
+			Exchange: pj.Exchange,
+			Pair:     pj.Pair,
+			Date:     date,
+			RelPath:  pj.ServerPath,
+			FullPath: pj.LocalPath,
+		}
+	}
+	return jobs
+}
+
+// printPlan reports the plan being executed.
+func printPlan(p *Plan, path string) {
+	pterm.Info.Printf("Executing plan %s: %d %s files from %s to %s, created %s\n",
+		path, len(p.Jobs), p.Type, p.StartDate, p.EndDate, p.CreatedAt.In(location).Format(time.DateTime))
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	previewType     string
+	previewExchange string
+	previewPair     string
+	previewDate     string
+	previewRows     int
+)
+
+// previewBlockSize is the unit preview fetches a remote file in. The parquet
+// decoder makes many small reads around the footer and the page headers, and
+// fetching whole blocks turns them into a few range requests.
+const previewBlockSize = 256 << 10
+
+var errUnknownFileSize = errors.New("the server didn't report the file size")
+
+func newPreviewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "preview",
+		Short: "Show the first rows of a file without downloading it",
+		Long: `Reads the footer and the start of the first row group of one file with
+HTTP range requests and shows its first rows as a table, to check a pair's
+data without downloading the whole file. Nothing is written to disk.`,
+		Run: runPreview,
+	}
+	cmd.Flags().StringVar(&previewType, "type", "trade", "Data type: "+strings.Join(supportedDataTypes(), ", "))
+	cmd.Flags().StringVar(&previewExchange, "exchange", "", "Exchange of the file")
+	cmd.Flags().StringVar(&previewPair, "pair", "", "Pair of the file, e.g. btc_usdt")
+	cmd.Flags().StringVar(&previewDate, "date", "", "Date (YYYY-MM-DD) of the file (default yesterday, UTC)")
+	cmd.Flags().IntVar(&previewRows, "rows", 10, "Number of rows to show")
+	_ = cmd.MarkFlagRequired("exchange")
+	_ = cmd.MarkFlagRequired("pair")
+	return cmd
+}
+
+func runPreview(cmd *cobra.Command, args []string) {
+	if _, ok := dataTypeFileParts[previewType]; !ok {
+		pterm.Error.Printf("Unknown data type: %s. Supported types: %s\n", previewType, strings.Join(supportedDataTypes(), ", "))
+		os.Exit(1)
+	}
+	if previewRows <= 0 {
+		pterm.Error.Println("--rows must be positive")
+		os.Exit(1)
+	}
+	if err := validateNames([]string{previewExchange}, []string{previewPair}); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	date := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	if previewDate != "" {
+		var err error
+		date, err = time.Parse(serverDateFormat, previewDate)
+		if err != nil {
+			pterm.Error.Printf("Invalid date: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := loadUserConfig(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if _, err := loadAPIKeySource(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("API_KEY")
+	}
+	if err := checkAPIKey(apiKey); err != nil {
+		pterm.Warning.Printf("%v; requests will likely be rejected\n", err)
+	}
+
+	relPath := getRelativePath(previewExchange, previewPair, previewType, date)
+	spinner, _ := pterm.DefaultSpinner.Start("Reading " + relPath + "...")
+	preview, err := readPreview(relPath, previewRows)
+	_ = spinner.Stop()
+	if err != nil {
+		pterm.Error.Printf("Failed to preview %s: %v\n", relPath, err)
+		os.Exit(1)
+	}
+
+	pterm.DefaultSection.Println("Preview")
+	pterm.Info.Printf("File: %s\n", relPath)
+	pterm.Info.Printf("Rows: %d in %d row groups, showing the first %d\n", preview.totalRows, preview.rowGroups, len(preview.rows))
+	pterm.Info.Printf("Fetched: %s of %s\n", formatSize(preview.fetched), formatSize(preview.size))
+	pterm.Println()
+	tableData := pterm.TableData{preview.columns}
+	tableData = append(tableData, preview.rows...)
+	renderTable(pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(tableData))
+}
+
+// filePreview is the first rows of a remote parquet file.
+type filePreview struct {
+	columns   []string
+	rows      [][]string
+	totalRows int64
+	rowGroups int
+	size      int64 // Size of the file
+	fetched   int64 // Bytes read from the server
+}
+
+// readPreview reads the first n rows of the file at relPath, fetching only
+// the blocks of the file the parquet decoder reads.
+func readPreview(relPath string, n int) (*filePreview, error) {
+	link, size, err := fetchDownloadLink(apiKey, relPath)
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		if size, err = remoteSize(link); err != nil {
+			return nil, err
+		}
+	}
+	return previewFile(link, size, n)
+}
+
+// previewFile reads the first n rows of the parquet file of the given size
+// at link.
+func previewFile(link string, size int64, n int) (*filePreview, error) {
+	r := &rangeReaderAt{url: link, size: size, blocks: make(map[int64][]byte)}
+	f, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, fmt.Errorf("reading parquet footer: %w", err)
+	}
+
+	preview := &filePreview{totalRows: f.NumRows(), rowGroups: len(f.RowGroups()), size: size}
+	leaves := f.Schema().Columns()
+	for _, path := range leaves {
+		preview.columns = append(preview.columns, strings.Join(path, "."))
+	}
+	for _, rg := range f.RowGroups() {
+		if len(preview.rows) >= n {
+			break
+		}
+		rows, err := readRows(rg, n-len(preview.rows), len(leaves))
+		preview.rows = append(preview.rows, rows...)
+		if err != nil {
+			return nil, fmt.Errorf("reading rows: %w", err)
+		}
+	}
+	preview.fetched = r.fetchedBytes()
+	return preview, nil
+}
+
+// readRows reads up to n rows of rg as one cell per leaf column.
+func readRows(rg parquet.RowGroup, n, columns int) ([][]string, error) {
+	rows := rg.Rows()
+	defer rows.Close()
+	buf := make([]parquet.Row, n)
+	read := 0
+	for read < n {
+		count, err := rows.ReadRows(buf[read:])
+		read += count
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	out := make([][]string, 0, read)
+	for _, row := range buf[:read] {
+		cells := make([]string, columns)
+		for _, v := range row {
+			col := v.Column()
+			if col < 0 || col >= columns {
+				continue
+			}
+			if cells[col] != "" {
+				cells[col] += ", "
+			}
+			cells[col] += formatPreviewValue(v)
+		}
+		out = append(out, cells)
+	}
+	return out, nil
+}
+
+// formatPreviewValue renders one value for the table: byte arrays as text,
+// nulls as "null".
+func formatPreviewValue(v parquet.Value) string {
+	switch {
+	case v.IsNull():
+		return "null"
+	case v.Kind() == parquet.ByteArray || v.Kind() == parquet.FixedLenByteArray:
+		return string(v.ByteArray())
+	}
+	return v.String()
+}
+
+// remoteSize returns the size of the file at link from the Content-Range of
+// a one-byte GET.
+func remoteSize(link string) (int64, error) {
+	header, err := probeHeaders(link, http.MethodGet)
+	if err != nil {
+		return 0, err
+	}
+	_, total, ok := strings.Cut(header.Get("Content-Range"), "/")
+	if !ok {
+		return 0, errUnknownFileSize
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, errUnknownFileSize
+	}
+	return size, nil
+}
+
+// rangeReaderAt is an io.ReaderAt over a remote file of a known size. It
+// fetches the file in previewBlockSize blocks with range requests, each
+// block once.
+type rangeReaderAt struct {
+	url  string
+	size int64
+
+	mu      sync.Mutex
+	blocks  map[int64][]byte
+	fetched int64
+}
+
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	n := 0
+	for n < len(p) && off+int64(n) < r.size {
+		pos := off + int64(n)
+		block, err := r.block(pos / previewBlockSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], block[pos%previewBlockSize:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns block i of the file, fetching it if needed.
+func (r *rangeReaderAt) block(i int64) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if block, ok := r.blocks[i]; ok {
+		return block, nil
+	}
+	from := i * previewBlockSize
+	to := min(from+previewBlockSize, r.size) - 1
+	block, err := fetchRange(r.url, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(block)) != to-from+1 {
+		return nil, fmt.Errorf("%w: got %d of %d bytes at offset %d", errSizeMismatch, len(block), to-from+1, from)
+	}
+	r.blocks[i] = block
+	r.fetched += int64(len(block))
+	return block, nil
+}
+
+func (r *rangeReaderAt) fetchedBytes() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fetched
+}
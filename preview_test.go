@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type previewTestRow struct {
+	Timestamp int64   `parquet:"timestamp"`
+	Price     float64 `parquet:"price"`
+	Side      string  `parquet:"side"`
+}
+
+// previewTestFile returns a parquet file of rows rows in row groups of
+// rowGroupRows rows.
+func previewTestFile(t *testing.T, rows, rowGroupRows int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[previewTestRow](&buf, parquet.MaxRowsPerRowGroup(int64(rowGroupRows)))
+	batch := make([]previewTestRow, rows)
+	for i := range batch {
+		side := "buy"
+		if i%2 == 1 {
+			side = "sell"
+		}
+		batch[i] = previewTestRow{Timestamp: int64(1000 + i), Price: float64(i) / 4, Side: side}
+	}
+	if _, err := w.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPreviewFileReadsFirstRowsOnly(t *testing.T) {
+	content := previewTestFile(t, 400000, 100000)
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeContent(w, r, "file.parquet", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	preview, err := previewFile(srv.URL, int64(len(content)), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"timestamp", "price", "side"}; !reflect.DeepEqual(preview.columns, want) {
+		t.Errorf("columns = %q, want %q", preview.columns, want)
+	}
+	want := [][]string{
+		{"1000", "0", "buy"},
+		{"1001", "0.25", "sell"},
+		{"1002", "0.5", "buy"},
+	}
+	if !reflect.DeepEqual(preview.rows, want) {
+		t.Errorf("rows = %q, want %q", preview.rows, want)
+	}
+	if preview.totalRows != 400000 || preview.rowGroups != 4 {
+		t.Errorf("totalRows, rowGroups = %d, %d, want 400000, 4", preview.totalRows, preview.rowGroups)
+	}
+	if preview.fetched >= preview.size/2 {
+		t.Errorf("fetched %d of %d bytes, want only the footer and the first row group", preview.fetched, preview.size)
+	}
+	if requests != int((preview.fetched+previewBlockSize-1)/previewBlockSize) {
+		t.Errorf("%d requests for %d bytes, want one per block", requests, preview.fetched)
+	}
+}
+
+func TestPreviewFileSpansRowGroups(t *testing.T) {
+	content := previewTestFile(t, 10, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.parquet", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	preview, err := previewFile(srv.URL, int64(len(content)), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(preview.rows) != 6 {
+		t.Fatalf("got %d rows, want 6", len(preview.rows))
+	}
+	if got := preview.rows[5][0]; got != "1005" {
+		t.Errorf("row 5 timestamp = %q, want %q", got, "1005")
+	}
+}
+
+func TestRemoteSize(t *testing.T) {
+	content := previewTestFile(t, 10, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.parquet", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	size, err := remoteSize(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != int64(len(content)) {
+		t.Errorf("remoteSize() = %d, want %d", size, len(content))
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneKeepDays int
+	pruneConfirm  bool
+)
+
+// Where the date of a local file is read from: the year/month/day folders of
+// the native layout, a date= (hive) or YYYY-MM-DD (--flatten-by date) folder,
+// or else the filename.
+var (
+	nativeDateDirs = regexp.MustCompile(`(?:^|/)(\d{4})/(\d{2})/(\d{2})(?:/|$)`)
+	dateDir        = regexp.MustCompile(`(?:^|/)(?:date=)?(\d{4}-\d{2}-\d{2})(?:/|$)`)
+	fileNameDate   = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+)
+
+func newPruneCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete local files older than a retention window",
+		Long: `Walks the output directory and deletes the downloaded files, unfinished
+.part files and .missing markers dated more than --keep-days days before today
+(UTC), keeping a rolling window of data. The date is read from the folders of
+the layout the file was saved in, or else from its filename; files without a
+recognizable date are never deleted. Nothing is deleted without --confirm.`,
+		Run: runPrune,
+	}
+	cmd.Flags().IntVar(&pruneKeepDays, "keep-days", 0, "Keep the files of this many days before today")
+	cmd.Flags().BoolVar(&pruneConfirm, "confirm", false, "Actually delete the files instead of only listing them")
+	_ = cmd.MarkFlagRequired("keep-days")
+	return cmd
+}
+
+// pruneCandidate is a local file dated before the retention window.
+type pruneCandidate struct {
+	path string
+	date time.Time
+	size int64
+}
+
+func runPrune(cmd *cobra.Command, args []string) {
+	if pruneKeepDays <= 0 {
+		pterm.Error.Println("--keep-days must be positive")
+		os.Exit(1)
+	}
+	if err := loadUserConfig(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	cutoff := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -pruneKeepDays)
+	pterm.DefaultSection.Println("Pruning Old Files")
+	pterm.Info.Printf("Directory: %s\n", outputDir)
+	pterm.Info.Printf("Keeping: files dated %s or later\n", cutoff.Format(serverDateFormat))
+	pterm.Println()
+
+	candidates, undated, err := pruneCandidates(outputDir, cutoff)
+	if err != nil {
+		pterm.Error.Printf("Failed to walk %s: %v\n", outputDir, err)
+		os.Exit(1)
+	}
+	if undated > 0 {
+		pterm.Info.Printf("%d files without a recognizable date are kept.\n", undated)
+	}
+	if len(candidates) == 0 {
+		pterm.Success.Println("No files are older than the retention window.")
+		return
+	}
+
+	var freed int64
+	var deleted int
+	var errs []error
+	tableData := [][]string{{"Date", "File", "Size"}}
+	for _, c := range candidates {
+		if pruneConfirm {
+			if err := os.Remove(c.path); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removeEmptyDirs(filepath.Dir(c.path), outputDir)
+		}
+		deleted++
+		freed += c.size
+		tableData = append(tableData, []string{c.date.Format(serverDateFormat), c.path, formatPruneSize(c.size)})
+	}
+	if deleted > 0 {
+		renderTable(pterm.DefaultTable.
+			WithHasHeader().
+			WithBoxed().
+			WithData(tableData))
+		pterm.Println()
+	}
+	for _, err := range errs {
+		pterm.Warning.Printf("Failed to delete: %v\n", err)
+	}
+
+	if !pruneConfirm {
+		pterm.Info.Printf("Would delete %d files, freeing %s. Run again with --confirm to delete them.\n", deleted, formatPruneSize(freed))
+		return
+	}
+	pterm.Success.Printf("Deleted %d files, freeing %s.\n", deleted, formatPruneSize(freed))
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+}
+
+// pruneCandidates lists the dataset files below dir dated before cutoff,
+// oldest first, and counts the dataset files whose date can't be told.
+func pruneCandidates(dir string, cutoff time.Time) ([]pruneCandidate, int, error) {
+	var candidates []pruneCandidate
+	undated := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !isDatasetFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		date, ok := localFileDate(filepath.ToSlash(rel))
+		if !ok {
+			undated++
+			return nil
+		}
+		if !date.Before(cutoff) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, pruneCandidate{path: path, date: date, size: info.Size()})
+		return nil
+	})
+	slices.SortStableFunc(candidates, func(a, b pruneCandidate) int { return a.date.Compare(b.date) })
+	return candidates, undated, err
+}
+
+// isDatasetFile reports whether name is a downloaded file, an unfinished
+// download or a --touch-missing marker, as opposed to the manifest, link
+// cache and other files kept in the output directory.
+func isDatasetFile(name string) bool {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, partSuffix), missingMarkerSuffix)
+	return strings.HasSuffix(name, ".parquet")
+}
+
+// localFileDate returns the date of the file at rel, a slash-separated path
+// below the output directory.
+func localFileDate(rel string) (time.Time, bool) {
+	if m := nativeDateDirs.FindStringSubmatch(rel); m != nil {
+		if date, err := time.Parse(serverDateFormat, m[1]+"-"+m[2]+"-"+m[3]); err == nil {
+			return date, true
+		}
+	}
+	if m := dateDir.FindStringSubmatch(rel); m != nil {
+		if date, err := time.Parse(serverDateFormat, m[1]); err == nil {
+			return date, true
+		}
+	}
+	if m := fileNameDate.FindString(filepath.Base(rel)); m != "" {
+		if date, err := time.Parse(serverDateFormat, m); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// removeEmptyDirs removes dir and its parents up to, but not including, root
+// for as long as they are empty, so pruning doesn't leave a tree of empty
+// date folders behind.
+func removeEmptyDirs(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil { // Not empty
+			return
+		}
+	}
+}
+
+// formatPruneSize is formatSize without "unknown" for the empty .missing
+// markers and .part files.
+func formatPruneSize(size int64) string {
+	return fmt.Sprintf("%.2f MB", float64(size)/1024/1024)
+}
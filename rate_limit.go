@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errInvalidRateLimit = errors.New("invalid --rate-limit")
+
+// RateLimits spaces out link requests (--rate-limit), per exchange where a
+// limit is set for it and under the fallback limit otherwise. A nil
+// *RateLimits, or a nil fallback, doesn't limit.
+type RateLimits struct {
+	exchanges map[string]*rateLimiter
+	fallback  *rateLimiter
+}
+
+// runRateLimits is the --rate-limit of the current invocation.
+var runRateLimits *RateLimits
+
+// parseRateLimits parses a comma-separated list of exchange=N entries and at
+// most one bare N, the fallback for the other exchanges. N is a number of
+// requests per second and may be fractional, e.g. 0.5 for one every two
+// seconds.
+func parseRateLimits(spec string) (*RateLimits, error) {
+	limits := &RateLimits{exchanges: make(map[string]*rateLimiter)}
+	for entry := range strings.SplitSeq(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		exchange, value, perExchange := strings.Cut(entry, "=")
+		if !perExchange {
+			value = exchange
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("%w: %q is not a positive number of requests per second", errInvalidRateLimit, entry)
+		}
+		limiter := newRateLimiter(rate)
+		if !perExchange {
+			if limits.fallback != nil {
+				return nil, fmt.Errorf("%w: more than one limit without an exchange", errInvalidRateLimit)
+			}
+			limits.fallback = limiter
+			continue
+		}
+		exchange = strings.TrimSpace(exchange)
+		if _, ok := limits.exchanges[exchange]; ok {
+			return nil, fmt.Errorf("%w: %s is limited twice", errInvalidRateLimit, exchange)
+		}
+		limits.exchanges[exchange] = limiter
+	}
+	return limits, nil
+}
+
+// Wait blocks until a link request for a file of exchange may be sent.
+func (l *RateLimits) Wait(exchange string) {
+	if l == nil {
+		return
+	}
+	if limiter, ok := l.exchanges[exchange]; ok {
+		limiter.wait()
+		return
+	}
+	l.fallback.wait()
+}
+
+// rateLimiter hands out evenly spaced slots, without bursts.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (r *rateLimiter) wait() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	delay := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+	time.Sleep(delay)
+}
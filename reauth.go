@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/pterm/pterm"
+)
+
+// Reauth fetches a fresh API key from --api-key-cmd when the API rejects the
+// current one mid-batch, as happens with short-lived tokens from a secret
+// manager. A nil *Reauth never refreshes, so a rejected key stays a hard
+// failure.
+type Reauth struct {
+	mu      sync.Mutex
+	command string
+	initial string // Key the batch started with, which callers still pass
+	current string
+}
+
+// runReauth is set when the API key comes from --api-key-cmd.
+var runReauth *Reauth
+
+func newReauth(command, key string) *Reauth {
+	return &Reauth{command: command, initial: key, current: key}
+}
+
+// Key returns the key to send in place of key: the latest refreshed key if
+// key is the one the batch started with, or key itself otherwise.
+func (r *Reauth) Key(key string) string {
+	if r == nil {
+		return key
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key == r.initial {
+		return r.current
+	}
+	return key
+}
+
+// Refresh re-runs the command after stale was rejected and returns the new
+// key. Workers that hit the rejection together share a single run: if the key
+// was already replaced since stale was sent, the replacement is returned.
+func (r *Reauth) Refresh(stale string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current != stale {
+		return r.current, nil
+	}
+	key, err := runAPIKeyCmd(r.command)
+	if err != nil {
+		return "", err
+	}
+	r.current = key
+	pterm.Info.Println("API key rejected; fetched a fresh one from --api-key-cmd.")
+	return key, nil
+}
+
+// canRefresh reports whether err is a rejected key that refreshing may fix:
+// a 401 or 403 from the API, for a file whose exchange doesn't have a key of
+// its own in the config file.
+func (r *Reauth) canRefresh(relPath string, err error) bool {
+	var apiErr *APIError
+	if r == nil || !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode != http.StatusUnauthorized && apiErr.StatusCode != http.StatusForbidden {
+		return false
+	}
+	return exchangeEndpoints[pathExchange(relPath)].APIKey == ""
+}
+
+var (
+	errReauthFailed        = errors.New("could not refresh the key")
+	errRejectedAfterReauth = errors.New("rejected again with a fresh key from --api-key-cmd")
+)
+
+// withReauth runs fetch with the current key and, if the API rejects it,
+// once more with a fresh key from --api-key-cmd.
+func withReauth(key, relPath string, fetch func(key string) (string, int64, error)) (string, int64, error) {
+	key = runReauth.Key(key)
+	link, size, err := fetch(key)
+	if !runReauth.canRefresh(relPath, err) {
+		return link, size, err
+	}
+	fresh, refreshErr := runReauth.Refresh(key)
+	if refreshErr != nil {
+		return "", 0, fmt.Errorf("%w (%w: %v)", err, errReauthFailed, refreshErr)
+	}
+	link, size, err = fetch(fresh)
+	if runReauth.canRefresh(relPath, err) {
+		err = fmt.Errorf("%w: %w", errRejectedAfterReauth, err)
+	}
+	return link, size, err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxRedirects is how many redirects a request may follow. Presigned links
+// point straight at the file, so anything beyond a hop or two is a
+// misconfigured CDN rather than a long but working chain.
+const maxRedirects = 5
+
+// RedirectError reports a request that was redirected in a loop or more than
+// maxRedirects times. Only the hosts of the chain are named; --debug-http logs
+// every hop.
+type RedirectError struct {
+	File  string   // Name of the requested file
+	Hosts []string // Hosts visited, in order, without consecutive repeats
+	Loop  bool     // The refused URL was already visited
+}
+
+func (e *RedirectError) Error() string {
+	hosts := strings.Join(e.Hosts, " -> ")
+	if e.Loop {
+		return fmt.Sprintf("redirect loop for %s (via %s)", e.File, hosts)
+	}
+	return fmt.Sprintf("too many redirects for %s (more than %d, via %s)", e.File, maxRedirects, hosts)
+}
+
+// checkRedirect is the CheckRedirect of every client. It refuses loops and
+// long chains with a *RedirectError, and logs each hop under --debug-http.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	runHTTPDebug.Redirect(req, via)
+	loop := slices.ContainsFunc(via, func(prev *http.Request) bool { return prev.URL.String() == req.URL.String() })
+	if !loop && len(via) <= maxRedirects {
+		return nil
+	}
+	var hosts []string
+	for _, r := range slices.Concat(via, []*http.Request{req}) {
+		if len(hosts) == 0 || hosts[len(hosts)-1] != r.URL.Host {
+			hosts = append(hosts, r.URL.Host)
+		}
+	}
+	return &RedirectError{File: path.Base(via[0].URL.Path), Hosts: hosts, Loop: loop}
+}
+
+// explainRedirect replaces the *url.Error around a *RedirectError, whose
+// message would repeat the full signed link, with the RedirectError itself.
+func explainRedirect(err error) error {
+	var redirectErr *RedirectError
+	if errors.As(err, &redirectErr) {
+		return redirectErr
+	}
+	return err
+}
+
+func redactedURL(req *http.Request) string {
+	return req.URL.Host + req.URL.Path
+}
+
+// Redirect logs one hop of a redirect chain: the status that caused it, where
+// it came from and where it goes.
+func (l *HTTPDebugLog) Redirect(req *http.Request, via []*http.Request) {
+	if l == nil {
+		return
+	}
+	status := 0
+	if req.Response != nil {
+		status = req.Response.StatusCode
+	}
+	line := fmt.Sprintf("%s REDIRECT %d %s -> %s hop=%d", time.Now().UTC().Format(time.RFC3339Nano),
+		status, redactedURL(via[len(via)-1]), redactedURL(req), len(via))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = fmt.Fprintln(l.file, line)
+}
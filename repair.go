@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	repairManifestPath string
+	repairDryRun       bool
+)
+
+var errWrongSize = errors.New("size differs from the manifest")
+
+// nativeRelPath matches a file saved in the native layout and captures its
+// exchange, data type, year, month, day and local pair name.
+var nativeRelPath = regexp.MustCompile(`^([^/]+)/([^/]+)/(\d{4})/(\d{2})/(\d{2})/([^/]+)/[^/]+\.parquet$`)
+
+func newRepairCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Download again only the corrupt or truncated local files",
+		Long: `Walks the output directory, validates every .parquet file like check-local
+(and against the size recorded in --manifest, if given) and downloads again
+only the files that fail. The server path of each file is taken from the
+manifest, or else rebuilt from the exchange, data type, date and pair of the
+native layout it was saved in. Files downloaded with --date-format,
+--token-mapping, --normalize-output or --path-pair-delimiter need the same
+flags here to be mapped back.`,
+		Run: runRepair,
+	}
+	cmd.Flags().StringVar(&repairManifestPath, "manifest", "", "Manifest written by --manifest, for server paths and expected sizes; updated with the repaired files")
+	cmd.Flags().BoolVar(&repairDryRun, "dry-run", false, "Only report the files that would be downloaded again")
+	cmd.Flags().StringVar(&dateFormat, "date-format", serverDateFormat, "--date-format the files were downloaded with")
+	cmd.Flags().StringVar(&tokenMappingPath, "token-mapping", "", "--token-mapping the files were downloaded with")
+	cmd.Flags().BoolVar(&normalizeOutput, "normalize-output", false, "Set if the files were downloaded with --normalize-output")
+	cmd.Flags().StringVar(&pathPairDelimiter, "path-pair-delimiter", "", "--path-pair-delimiter the files were downloaded with")
+	return cmd
+}
+
+// repairTarget is a local file and what is known about it on the server.
+type repairTarget struct {
+	path     string
+	relPath  string // Empty if the file can't be mapped to a server path
+	expected int64  // Size recorded in the manifest, 0 if unknown
+}
+
+func runRepair(cmd *cobra.Command, args []string) {
+	if err := loadUserConfig(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if tokenMappingPath != "" {
+		var err error
+		tokenMapping, err = loadTokenMapping(tokenMappingPath)
+		if err != nil {
+			pterm.Error.Printf("Failed to read token mapping: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var manifest *Manifest
+	if repairManifestPath != "" {
+		var err error
+		manifest, err = loadManifest(repairManifestPath)
+		if err != nil {
+			pterm.Error.Printf("Failed to read manifest: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	pterm.DefaultSection.Println("Repairing Local Files")
+	pterm.Info.Printf("Directory: %s\n", outputDir)
+	pterm.Println()
+
+	var broken []repairTarget
+	var problems []error
+	healthy := 0
+	err := filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".parquet") {
+			return nil
+		}
+		target := resolveRepairTarget(path, manifest)
+		if err := validateRepairTarget(target); err != nil {
+			broken = append(broken, target)
+			problems = append(problems, err)
+			return nil
+		}
+		healthy++
+		return nil
+	})
+	if err != nil {
+		pterm.Error.Printf("Failed to walk %s: %v\n", outputDir, err)
+		os.Exit(1)
+	}
+	if healthy+len(broken) == 0 {
+		pterm.Warning.Println("No parquet files found.")
+		return
+	}
+	if len(broken) == 0 {
+		pterm.Success.Printf("All %d files are healthy.\n", healthy)
+		return
+	}
+
+	if !repairDryRun {
+		if _, err := loadAPIKeySource(cmd); err != nil {
+			pterm.Error.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		if apiKey == "" {
+			apiKey = os.Getenv("API_KEY")
+		}
+		if err := checkAPIKey(apiKey); err != nil {
+			pterm.Warning.Printf("%v; requests will likely be rejected\n", err)
+		}
+	}
+
+	tableData := [][]string{{"Status", "File", "Problem", "Details"}}
+	var repaired, failed, unmapped int
+	for i, target := range broken {
+		row := []string{"", target.path, problems[i].Error(), ""}
+		switch {
+		case target.relPath == "":
+			unmapped++
+			row[0] = pterm.Yellow("UNKNOWN")
+			row[3] = "not in the manifest, and not a native layout path"
+		case repairDryRun:
+			row[0] = pterm.Yellow("BROKEN")
+			row[3] = target.relPath
+		default:
+			spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Downloading %s (%d/%d)...", target.relPath, i+1, len(broken)))
+			size, err := repairFile(target)
+			_ = spinner.Stop()
+			if err != nil {
+				failed++
+				row[0] = pterm.Red("FAILED")
+				row[3] = err.Error()
+				break
+			}
+			repaired++
+			row[0] = pterm.Green("REPAIRED")
+			row[3] = formatSize(size)
+			manifest.Repaired(target.path, size)
+		}
+		tableData = append(tableData, row)
+	}
+	if err := manifest.Save(); err != nil {
+		pterm.Warning.Printf("Failed to save manifest: %v\n", err)
+	}
+
+	renderTable(pterm.DefaultTable.
+		WithHasHeader().
+		WithBoxed().
+		WithData(tableData))
+
+	pterm.Println()
+	if repairDryRun {
+		pterm.Info.Printf("Healthy: %d, To repair: %d, Unknown: %d\n", healthy, len(broken)-unmapped, unmapped)
+		return
+	}
+	pterm.Info.Printf("Healthy: %d, Repaired: %d, Failed: %d, Unknown: %d\n", healthy, repaired, failed, unmapped)
+	if unmapped > 0 {
+		pterm.Info.Println("Unknown files need --manifest, or the --date-format, --token-mapping, --normalize-output and --path-pair-delimiter they were downloaded with.")
+	}
+	if failed+unmapped > 0 {
+		os.Exit(1)
+	}
+}
+
+// resolveRepairTarget looks up the server path and expected size of the file
+// at path: from the manifest if it lists the file, or else from its position
+// in the native layout.
+func resolveRepairTarget(path string, manifest *Manifest) repairTarget {
+	target := repairTarget{path: path}
+	if entry, ok := manifest.Entry(path); ok {
+		target.relPath = entry.ServerPath
+		target.expected = entry.Size
+		return target
+	}
+	target.relPath = nativeServerPath(path)
+	return target
+}
+
+// nativeServerPath returns the server path of a file saved in the native
+// layout, or "" if path isn't one. The local path can differ from the server
+// path (--date-format, --token-mapping, --normalize-output,
+// --path-pair-delimiter), so the server path is rebuilt from the exchange,
+// data type, date and pair, and only trusted if they lead back to path.
+func nativeServerPath(path string) string {
+	rel, err := filepath.Rel(outputDir, path)
+	if err != nil {
+		return ""
+	}
+	m := nativeRelPath.FindStringSubmatch(filepath.ToSlash(rel))
+	if m == nil {
+		return ""
+	}
+	exchange, dType, pair := m[1], m[2], serverPairOf(m[6])
+	if _, ok := dataTypeFileParts[dType]; !ok {
+		return ""
+	}
+	date, err := time.Parse("2006-01-02", m[3]+"-"+m[4]+"-"+m[5])
+	if err != nil {
+		return ""
+	}
+	if getLocalPath(exchange, pair, dType, date) != filepath.Clean(path) {
+		return ""
+	}
+	return getRelativePath(exchange, pair, dType, date)
+}
+
+// serverPairOf returns the server pair whose local folder is localPair,
+// undoing --token-mapping.
+func serverPairOf(localPair string) string {
+	for server, local := range tokenMapping {
+		if localPathPart(local) == localPair {
+			return server
+		}
+	}
+	return localPair
+}
+
+// validateRepairTarget runs the check-local validation plus, when the
+// manifest recorded one, a size check.
+func validateRepairTarget(target repairTarget) error {
+	if err := validateParquetFile(target.path); err != nil {
+		return err
+	}
+	if target.expected <= 0 {
+		return nil
+	}
+	info, err := os.Stat(target.path)
+	if err != nil {
+		return err
+	}
+	if info.Size() != target.expected {
+		return fmt.Errorf("%w: %d bytes instead of %d", errWrongSize, info.Size(), target.expected)
+	}
+	return nil
+}
+
+// repairFile downloads the file again over the broken one, which is only
+// replaced once the new copy is complete, and validates the result.
+func repairFile(target repairTarget) (int64, error) {
+	link, size, err := fetchDownloadLink(apiKey, target.relPath)
+	if err != nil {
+		return 0, err
+	}
+	written, _, err := download(link, target.path, size, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := validateParquetFile(target.path); err != nil {
+		return 0, fmt.Errorf("still invalid after downloading: %w", err)
+	}
+	return written, nil
+}
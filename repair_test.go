@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNativeServerPath(t *testing.T) {
+	savedDir, savedFormat, savedDelimiter, savedMapping := outputDir, dateFormat, pathPairDelimiter, tokenMapping
+	t.Cleanup(func() {
+		outputDir, dateFormat, pathPairDelimiter, tokenMapping = savedDir, savedFormat, savedDelimiter, savedMapping
+	})
+	outputDir = filepath.FromSlash("/data")
+	const server = "binance/trade/2025/01/02/btc_usdt/binance_trades_2025-01-02_btc_usdt.parquet"
+
+	tests := []struct {
+		name       string
+		format     string
+		delimiter  string
+		mapping    map[string]string
+		local      string
+		wantServer string
+	}{
+		{"native", serverDateFormat, "", nil, server, server},
+		{"date format", "20060102", "", nil,
+			"binance/trade/2025/01/02/btc_usdt/binance_trades_20250102_btc_usdt.parquet", server},
+		{"date format not given", serverDateFormat, "", nil,
+			"binance/trade/2025/01/02/btc_usdt/binance_trades_20250102_btc_usdt.parquet", ""},
+		{"token mapping", serverDateFormat, "", map[string]string{"btc_usdt": "BTCUSDT"},
+			"binance/trade/2025/01/02/BTCUSDT/binance_trades_2025-01-02_BTCUSDT.parquet", server},
+		{"pair delimiter", serverDateFormat, "-", nil, server,
+			"binance/trade/2025/01/02/btc-usdt/binance_trades_2025-01-02_btc-usdt.parquet"},
+		{"unknown data type", serverDateFormat, "", nil,
+			"binance/quotes/2025/01/02/btc_usdt/binance_quotes_2025-01-02_btc_usdt.parquet", ""},
+		{"hive layout", serverDateFormat, "", nil,
+			"exchange=binance/pair=btc_usdt/date=2025-01-02/binance_trades_2025-01-02_btc_usdt.parquet", ""},
+	}
+	for _, tt := range tests {
+		dateFormat, pathPairDelimiter, tokenMapping = tt.format, tt.delimiter, tt.mapping
+		got := nativeServerPath(filepath.Join(outputDir, filepath.FromSlash(tt.local)))
+		if got != tt.wantServer {
+			t.Errorf("%s: nativeServerPath(%q) = %q, want %q", tt.name, tt.local, got, tt.wantServer)
+		}
+	}
+}
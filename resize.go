@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// resizeSettle is how long the terminal must stay the same size before the
+// progress area is redrawn, so dragging a window edge redraws once.
+const resizeSettle = 150 * time.Millisecond
+
+// watchResize redraws the live progress bars written to w whenever the
+// terminal is resized. The bars are redrawn in place by moving the cursor up
+// over the lines drawn last time, which goes wrong once a resize rewraps those
+// lines: the leftovers of old frames pile up on screen. Clearing the screen
+// and starting from its top lets the next frame be drawn from a clean slate.
+// On platforms without resize signals it does nothing. The returned function
+// stops watching.
+func watchResize(w io.Writer) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	if !notifyResize(sigs) {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigs:
+			}
+			// Wait for the size to settle.
+			for settled := false; !settled; {
+				select {
+				case <-done:
+					return
+				case <-sigs:
+				case <-time.After(resizeSettle):
+					settled = true
+				}
+			}
+			_, _ = fmt.Fprint(w, "\x1b[H\x1b[2J")
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
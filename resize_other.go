@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyResize reports that resizes can't be observed: there is no SIGWINCH
+// outside Unix.
+func notifyResize(sigs chan<- os.Signal) bool {
+	return false
+}
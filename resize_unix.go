@@ -0,0 +1,16 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyResize relays SIGWINCH, which the terminal sends on every resize, to
+// sigs.
+func notifyResize(sigs chan<- os.Signal) bool {
+	signal.Notify(sigs, syscall.SIGWINCH)
+	return true
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultEntry is one line of the --results-file log.
+type resultEntry struct {
+	Timestamp       string  `json:"timestamp"`
+	Type            string  `json:"type"`
+	Exchange        string  `json:"exchange"`
+	Pair            string  `json:"pair"`
+	Date            string  `json:"date"`
+	Path            string  `json:"path"`
+	Status          string  `json:"status"`
+	Bytes           int64   `json:"bytes"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+	jobTimeline
+}
+
+// jobTimeline is when a job was queued, picked up by a worker and finished,
+// with sub-second precision, and which worker ran it, for timeline analysis.
+// Jobs that never ran have no queued_at, started_at or worker.
+type jobTimeline struct {
+	QueuedAt   string `json:"queued_at,omitempty"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at"`
+	Worker     int    `json:"worker,omitempty"`
+}
+
+func newJobTimeline(result JobResult) jobTimeline {
+	return jobTimeline{
+		QueuedAt:   formatTimelineTime(result.Queued),
+		StartedAt:  formatTimelineTime(result.Started),
+		FinishedAt: formatTimelineTime(result.Finished),
+		Worker:     result.Worker,
+	}
+}
+
+// ResultsLog appends one JSON object per finished job to the --results-file,
+// as each job finishes, so even a crashed run leaves a record behind. A nil
+// *ResultsLog is valid and records nothing.
+type ResultsLog struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func openResultsLog(path string) (*ResultsLog, error) {
+	if err := mkdirOutput(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultsLog{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (l *ResultsLog) Record(job Job, result JobResult) {
+	if l == nil {
+		return
+	}
+	entry := resultEntry{
+		Timestamp:       time.Now().UTC().Format(time.RFC3339),
+		Type:            dataType,
+		Exchange:        job.Exchange,
+		Pair:            job.Pair,
+		Date:            job.Date.Format(serverDateFormat),
+		Path:            job.FullPath,
+		Status:          result.Status.String(),
+		Bytes:           result.Bytes,
+		DurationSeconds: result.Duration.Seconds(),
+		jobTimeline:     newJobTimeline(result),
+	}
+	if result.Err != nil {
+		entry.Error = result.Err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.enc.Encode(entry)
+}
+
+// formatTimelineTime formats t in UTC with nanoseconds, or "" if t is zero.
+func formatTimelineTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (l *ResultsLog) Close() {
+	if l == nil {
+		return
+	}
+	_ = l.file.Close()
+}
+
+var errInvalidResultsLog = errors.New("invalid results file")
+
+// planFromResultsLog rebuilds the jobs recorded in a --results-file as a plan,
+// for --replay-from-log. Every job is kept, whatever its status, so the whole
+// run is reproduced; a job recorded more than once (e.g. retried) appears once.
+func planFromResultsLog(path string) (*Plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &Plan{Version: planVersion, CreatedAt: time.Now().UTC()}
+	seen := make(map[string]bool)
+	dec := json.NewDecoder(f)
+	for line := 1; ; line++ {
+		var entry resultEntry
+		if err := dec.Decode(&entry); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %s: entry %d: %v", errInvalidResultsLog, path, line, err)
+		}
+		if p.Type == "" {
+			p.Type = entry.Type
+		} else if entry.Type != p.Type {
+			return nil, fmt.Errorf("%w: %s: mixes %s and %s jobs", errInvalidResultsLog, path, p.Type, entry.Type)
+		}
+		date, err := time.Parse(serverDateFormat, entry.Date)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: entry %d: invalid date %q", errInvalidResultsLog, path, line, entry.Date)
+		}
+		if seen[entry.Path] {
+			continue
+		}
+		seen[entry.Path] = true
+		p.Jobs = append(p.Jobs, PlanJob{
+			Exchange:   entry.Exchange,
+			Pair:       entry.Pair,
+			Date:       entry.Date,
+			ServerPath: getRelativePath(entry.Exchange, entry.Pair, entry.Type, date),
+			LocalPath:  entry.Path,
+		})
+	}
+	if len(p.Jobs) == 0 {
+		return nil, fmt.Errorf("%w: %s: no jobs", errInvalidResultsLog, path)
+	}
+	if _, ok := dataTypeFileParts[p.Type]; !ok {
+		return nil, fmt.Errorf("%w: %s: unknown type %q", errInvalidResultsLog, path, p.Type)
+	}
+
+	// Jobs finish out of order; run them in the usual date order.
+	slices.SortStableFunc(p.Jobs, func(a, b PlanJob) int { return strings.Compare(a.Date, b.Date) })
+	p.StartDate, p.EndDate = p.Jobs[0].Date, p.Jobs[len(p.Jobs)-1].Date
+	return p, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryBudget caps the retry attempts of a whole batch (--max-total-retries).
+// A limit of 0 means unlimited. A nil *RetryBudget allows every retry.
+type RetryBudget struct {
+	mu        sync.Mutex
+	limit     int
+	used      int
+	exhausted bool
+}
+
+// runRetries is the retry budget of the current invocation.
+var runRetries *RetryBudget
+
+// Take claims one retry attempt, reporting false once the budget is spent.
+func (b *RetryBudget) Take() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit > 0 && b.used >= b.limit {
+		b.exhausted = true
+		return false
+	}
+	b.used++
+	return true
+}
+
+// Used returns the number of retry attempts claimed so far.
+func (b *RetryBudget) Used() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// Exhausted reports whether a retry was refused because the budget ran out.
+func (b *RetryBudget) Exhausted() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exhausted
+}
+
+// Error categories reported in the failure summary.
+const (
+	categoryDNS         = "dns"
+	categoryConnection  = "connection"
+	categoryTimeout     = "timeout"
+	categoryRateLimited = "rate_limited"
+	categoryServer      = "server_error"
+	categoryIncomplete  = "incomplete"
+	categoryNotFound    = "not_found"
+	categoryAuth        = "auth"
+	categoryAuthRefresh = "auth_refresh"
+	categoryClient      = "client_error"
+	categorySimulated   = "simulated"
+	categoryFileLimit   = "file_limit"
+	categoryRedirect    = "redirect"
+	categoryOther       = "other"
+)
+
+// classifyError sorts a failure into a category, so that transient network
+// problems can be told apart from deterministic failures.
+func classifyError(err error) string {
+	if errors.Is(err, errFileNotFound) {
+		return categoryNotFound
+	}
+	if errors.Is(err, errSimulatedFailure) {
+		return categorySimulated
+	}
+	if errors.Is(err, errReauthFailed) || errors.Is(err, errRejectedAfterReauth) {
+		return categoryAuthRefresh
+	}
+	var redirectErr *RedirectError
+	if errors.As(err, &redirectErr) {
+		return categoryRedirect
+	}
+
+	status := 0
+	var apiErr *APIError
+	var statusErr *StatusError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.StatusCode
+	case errors.As(err, &statusErr):
+		status = statusErr.StatusCode
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return categoryAuth
+	case status == http.StatusNotFound:
+		return categoryNotFound
+	case status == http.StatusRequestTimeout:
+		return categoryTimeout
+	case status == http.StatusTooManyRequests:
+		return categoryRateLimited
+	case status >= 500:
+		return categoryServer
+	case status >= 400:
+		return categoryClient
+	}
+
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return categoryDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return categoryTimeout
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return categoryConnection
+	case errors.Is(err, errSizeMismatch), errors.Is(err, errUnexpectedPartialContent):
+		return categoryIncomplete
+	case isFileLimit(err):
+		return categoryFileLimit
+	}
+	return categoryOther
+}
+
+// isRetryable reports whether a failed attempt may succeed if repeated:
+// network trouble, timeouts, rate limiting, server errors, truncated
+// downloads and running out of file descriptors, which other downloads free
+// up as they finish. Missing files, rejected credentials and other client errors
+// fail the same way every time.
+func isRetryable(err error) bool {
+	return retryableCategory(classifyError(err))
+}
+
+func retryableCategory(category string) bool {
+	switch category {
+	case categoryDNS, categoryConnection, categoryTimeout, categoryRateLimited,
+		categoryServer, categoryIncomplete, categoryFileLimit:
+		return true
+	}
+	return false
+}
+
+// retryDelay is the pause before the given retry attempt (1-based): one
+// second, doubling with every attempt up to 30 seconds.
+func retryDelay(attempt int) time.Duration {
+	return min(time.Second<<min(attempt-1, 5), 30*time.Second)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Scheduler runs a queue of jobs on a pool of workers and aggregates their
+// results into RunStats. It does no rendering or I/O of its own: what a job
+// does and how its outcome is shown are supplied by the caller, so the
+// orchestration works the same with progress bars, plain output or no UI at
+// all.
+type Scheduler struct {
+	// Workers is the number of jobs processed concurrently.
+	Workers int
+	// Process runs one job. It is called from the worker goroutines.
+	Process func(job Job) JobResult
+	// NotStarted, if set, is called for each job that is skipped because the
+	// batch was stopped early.
+	NotStarted func(job Job)
+	// OnResult, if set, observes every recorded result. Calls are serialized.
+	OnResult func(job Job, result JobResult)
+	// MaxFailures stops the batch once this many jobs have failed (0 = never).
+	MaxFailures int
+	// Deadline, if set, stops the batch from starting new jobs once reached.
+	Deadline time.Time
+
+	jobs   []Job
+	queued []time.Time // Per job, when Run queued it
+	mu     sync.Mutex
+	stats  RunStats
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewScheduler returns a scheduler for jobs. Results are reported by index
+// into jobs.
+func NewScheduler(jobs []Job) *Scheduler {
+	return &Scheduler{
+		Workers: 1,
+		jobs:    jobs,
+		queued:  make([]time.Time, len(jobs)),
+		stats:   RunStats{Total: int64(len(jobs)), Results: make([]JobResult, len(jobs))},
+	}
+}
+
+// Record adds the result of the job at idx. It is used for jobs settled
+// without running them, such as ones completed by a previous run.
+func (s *Scheduler) Record(idx int, result JobResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.jobs[idx]
+	result.Queued = s.queued[idx]
+	result.Finished = time.Now()
+	result.Path = job.FullPath
+	result.Exchange = job.Exchange
+	result.Date = job.Date
+	result.Unlisted = job.Unlisted
+	s.stats.Results[idx] = result
+	s.stats.add(result)
+	if result.Small {
+		s.stats.SmallFiles = append(s.stats.SmallFiles, result.Path)
+	}
+	if s.OnResult != nil {
+		s.OnResult(job, result)
+	}
+
+	if s.MaxFailures > 0 && s.stats.Failed >= int64(s.MaxFailures) && s.stats.StopReason == "" {
+		s.stats.StopReason = fmt.Sprintf("aborted after %d failures", s.stats.Failed)
+		if s.cancel != nil {
+			s.cancel()
+		}
+	}
+}
+
+// Run processes the jobs at the pending indexes and returns the totals of the
+// whole batch, including results added with Record. Once the batch is stopped,
+// the remaining jobs are recorded as not started.
+func (s *Scheduler) Run(pending []int) RunStats {
+	ctx, cancel := context.WithCancel(context.Background())
+	if !s.Deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, s.Deadline)
+	}
+	defer cancel()
+
+	s.mu.Lock()
+	s.ctx, s.cancel = ctx, cancel
+	// Results recorded before Run may already have hit MaxFailures.
+	if s.stats.StopReason != "" {
+		cancel()
+	}
+	queued := time.Now()
+	for _, idx := range pending {
+		s.queued[idx] = queued
+	}
+	s.mu.Unlock()
+
+	jobsCh := make(chan int, len(pending))
+	var wg sync.WaitGroup
+	for worker := range max(s.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobsCh {
+				if ctx.Err() != nil {
+					if s.NotStarted != nil {
+						s.NotStarted(s.jobs[idx])
+					}
+					s.Record(idx, JobResult{Status: StatusNotStarted})
+					continue
+				}
+				started := time.Now()
+				result := s.Process(s.jobs[idx])
+				result.Started, result.Worker = started, worker+1
+				s.Record(idx, result)
+			}
+		}()
+	}
+	for _, idx := range pending {
+		jobsCh <- idx
+	}
+	close(jobsCh)
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Done returns how many jobs have a result so far.
+func (s *Scheduler) Done() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	return st.Success + st.Skipped + st.Failed + st.NotStarted + st.Missing
+}
+
+// Total returns the number of jobs in the batch.
+func (s *Scheduler) Total() int64 {
+	return s.stats.Total
+}
+
+// DeadlineExceeded reports whether the batch stopped because its Deadline
+// passed.
+func (s *Scheduler) DeadlineExceeded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ctx != nil && errors.Is(s.ctx.Err(), context.DeadlineExceeded)
+}
+
+// forEachParallel calls fn for every index in [0, n) on up to workers
+// goroutines, and returns once every call has returned. It is the simple
+// fan-out used by the link probes, which need none of the Scheduler's
+// results, deadlines or failure limits.
+func forEachParallel(n, workers int, fn func(i int)) {
+	idxCh := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(workers, 1), max(n, 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxCh {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		idxCh <- i
+	}
+	close(idxCh)
+	wg.Wait()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testJobs(n int) []Job {
+	jobs := make([]Job, n)
+	for i := range jobs {
+		jobs[i] = Job{Index: i, Total: n, Exchange: "binance", FullPath: fmt.Sprintf("out/%d.parquet", i)}
+	}
+	return jobs
+}
+
+func TestSchedulerRunsPendingJobsInOrder(t *testing.T) {
+	jobs := testJobs(4)
+	var order []string
+	s := NewScheduler(jobs)
+	s.Process = func(job Job) JobResult {
+		order = append(order, job.FullPath)
+		return JobResult{Status: StatusSuccess, Bytes: 10}
+	}
+
+	stats := s.Run([]int{3, 1, 2})
+
+	want := []string{"out/3.parquet", "out/1.parquet", "out/2.parquet"}
+	if !slices.Equal(order, want) {
+		t.Errorf("processed %v, want %v", order, want)
+	}
+	if stats.Success != 3 || stats.Bytes != 30 {
+		t.Errorf("got %d succeeded and %d bytes, want 3 and 30", stats.Success, stats.Bytes)
+	}
+	for _, idx := range []int{1, 2, 3} {
+		result := stats.Results[idx]
+		if result.Path != jobs[idx].FullPath {
+			t.Errorf("result %d has path %q, want %q", idx, result.Path, jobs[idx].FullPath)
+		}
+		if result.Worker != 1 || result.Queued.IsZero() || result.Started.Before(result.Queued) || result.Finished.Before(result.Started) {
+			t.Errorf("result %d has worker %d and timeline %v, %v, %v", idx, result.Worker, result.Queued, result.Started, result.Finished)
+		}
+	}
+	if s.Done() != 3 || s.Total() != 4 {
+		t.Errorf("Done() = %d, Total() = %d, want 3 and 4", s.Done(), s.Total())
+	}
+}
+
+func TestSchedulerRecord(t *testing.T) {
+	jobs := testJobs(2)
+	var observed []string
+	s := NewScheduler(jobs)
+	s.Process = func(job Job) JobResult { return JobResult{Status: StatusSuccess} }
+	s.OnResult = func(job Job, result JobResult) {
+		observed = append(observed, job.FullPath+" "+result.Status.String())
+	}
+
+	s.Record(0, JobResult{Status: StatusSkipped, Small: true})
+	stats := s.Run([]int{1})
+
+	if stats.Skipped != 1 || stats.Success != 1 {
+		t.Errorf("got %d skipped and %d succeeded, want 1 and 1", stats.Skipped, stats.Success)
+	}
+	if got := stats.Results[0]; got.Path != jobs[0].FullPath || !got.Queued.IsZero() || got.Worker != 0 || got.Finished.IsZero() {
+		t.Errorf("recorded result = %+v, want the job's path, no queue time or worker and a finish time", got)
+	}
+	if !slices.Equal(stats.SmallFiles, []string{jobs[0].FullPath}) {
+		t.Errorf("small files = %v, want %v", stats.SmallFiles, []string{jobs[0].FullPath})
+	}
+	want := []string{"out/0.parquet skipped", "out/1.parquet success"}
+	if !slices.Equal(observed, want) {
+		t.Errorf("OnResult saw %v, want %v", observed, want)
+	}
+}
+
+func TestSchedulerLimitsConcurrency(t *testing.T) {
+	const workers = 3
+	jobs := testJobs(12)
+	var running, peak atomic.Int32
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	s := NewScheduler(jobs)
+	s.Workers = workers
+	s.Process = func(job Job) JobResult {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return JobResult{Status: StatusSuccess}
+	}
+	s.OnResult = func(job Job, result JobResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[result.Worker] = true
+	}
+
+	stats := s.Run([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11})
+
+	if stats.Success != 12 {
+		t.Errorf("got %d succeeded, want 12", stats.Success)
+	}
+	if p := peak.Load(); p != workers {
+		t.Errorf("%d jobs ran at once, want %d", p, workers)
+	}
+	for worker := range seen {
+		if worker < 1 || worker > workers {
+			t.Errorf("result from worker %d, want 1 to %d", worker, workers)
+		}
+	}
+}
+
+func TestSchedulerAbortsAfterMaxFailures(t *testing.T) {
+	jobs := testJobs(5)
+	var processed, notStarted int
+	s := NewScheduler(jobs)
+	s.MaxFailures = 2
+	s.Process = func(job Job) JobResult {
+		processed++
+		return JobResult{Status: StatusFailed, Err: errors.New("boom")}
+	}
+	s.NotStarted = func(job Job) { notStarted++ }
+
+	stats := s.Run([]int{0, 1, 2, 3, 4})
+
+	if processed != 2 || notStarted != 3 {
+		t.Errorf("processed %d and skipped %d jobs, want 2 and 3", processed, notStarted)
+	}
+	if stats.Failed != 2 || stats.NotStarted != 3 {
+		t.Errorf("got %d failed and %d not started, want 2 and 3", stats.Failed, stats.NotStarted)
+	}
+	if stats.StopReason != "aborted after 2 failures" {
+		t.Errorf("stop reason = %q", stats.StopReason)
+	}
+	if s.DeadlineExceeded() {
+		t.Error("DeadlineExceeded() = true for an abort")
+	}
+}
+
+func TestSchedulerAbortsOnRecordedFailures(t *testing.T) {
+	jobs := testJobs(3)
+	s := NewScheduler(jobs)
+	s.MaxFailures = 1
+	s.Process = func(job Job) JobResult {
+		t.Errorf("processed %s after the batch was aborted", job.FullPath)
+		return JobResult{Status: StatusSuccess}
+	}
+
+	s.Record(0, JobResult{Status: StatusFailed, Err: errors.New("boom")})
+	stats := s.Run([]int{1, 2})
+
+	if stats.Failed != 1 || stats.NotStarted != 2 {
+		t.Errorf("got %d failed and %d not started, want 1 and 2", stats.Failed, stats.NotStarted)
+	}
+}
+
+func TestSchedulerStopsAtDeadline(t *testing.T) {
+	jobs := testJobs(3)
+	s := NewScheduler(jobs)
+	s.Deadline = time.Now().Add(-time.Second)
+	s.Process = func(job Job) JobResult {
+		t.Errorf("processed %s after the deadline", job.FullPath)
+		return JobResult{Status: StatusSuccess}
+	}
+
+	stats := s.Run([]int{0, 1, 2})
+
+	if stats.NotStarted != 3 {
+		t.Errorf("got %d not started, want 3", stats.NotStarted)
+	}
+	if !s.DeadlineExceeded() {
+		t.Error("DeadlineExceeded() = false after the deadline passed")
+	}
+	if got := stats.Results[0]; got.Worker != 0 || !got.Started.IsZero() {
+		t.Errorf("not started result = %+v, want no worker or start time", got)
+	}
+}
+
+func TestForEachParallelCallsEveryIndexOnce(t *testing.T) {
+	for _, tt := range []struct{ n, workers int }{{0, 4}, {1, 4}, {10, 1}, {10, 3}, {3, 10}, {5, 0}} {
+		counts := make([]atomic.Int32, tt.n)
+		var running, peak atomic.Int32
+		forEachParallel(tt.n, tt.workers, func(i int) {
+			now := running.Add(1)
+			for {
+				p := peak.Load()
+				if now <= p || peak.CompareAndSwap(p, now) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			counts[i].Add(1)
+			running.Add(-1)
+		})
+		for i := range counts {
+			if c := counts[i].Load(); c != 1 {
+				t.Errorf("n=%d workers=%d: index %d called %d times, want 1", tt.n, tt.workers, i, c)
+			}
+		}
+		if p := int(peak.Load()); p > max(tt.workers, 1) {
+			t.Errorf("n=%d workers=%d: %d calls ran at once", tt.n, tt.workers, p)
+		}
+	}
+}
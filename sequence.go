@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pterm/pterm"
+)
+
+// Sequence hands out the numbers prefixed to local filenames with
+// --sequence-file. Numbers continue across runs and a file keeps the number
+// it was first given, so re-running a range finds the files it already
+// downloaded. A nil *Sequence is valid and numbers nothing.
+type Sequence struct {
+	mu       sync.Mutex
+	path     string
+	Next     int64            `json:"next"`
+	Assigned map[string]int64 `json:"assigned"` // Server path -> number
+}
+
+// runSequence is the --sequence-file of the current invocation.
+var runSequence *Sequence
+
+// loadSequence reads the sequence at path. A missing file starts at 1.
+func loadSequence(path string) (*Sequence, error) {
+	s := &Sequence{path: path, Next: 1, Assigned: make(map[string]int64)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.Assigned == nil {
+		s.Assigned = make(map[string]int64)
+	}
+	return s, nil
+}
+
+// Number returns the number of the file at relPath, assigning the next one
+// if it has none yet.
+func (s *Sequence) Number(relPath string) int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.Assigned[relPath]
+	if !ok {
+		n = s.Next
+		s.Next++
+		s.Assigned[relPath] = n
+	}
+	return n
+}
+
+// Save writes the sequence back to its file, replacing it atomically.
+func (s *Sequence) Save() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// saveSequence persists the numbers assigned so far. It runs before anything
+// is downloaded, so a crash can never hand the same number out twice; if the
+// file can't be written the run stops.
+func saveSequence() {
+	if err := runSequence.Save(); err != nil {
+		pterm.Error.Printf("Failed to save sequence file: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// sequencedPath prefixes the filename of fullPath with its sequence number.
+func sequencedPath(fullPath string, n int64) string {
+	dir, name := filepath.Split(fullPath)
+	return filepath.Join(dir, fmt.Sprintf("%06d_%s", n, name))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+var (
+	errSimulatedFailure  = errors.New("simulated failure (--simulate-failures)")
+	errInvalidSimulation = errors.New("invalid --simulate-failures")
+)
+
+// FailureSimulation makes a random fraction of jobs fail on purpose, so
+// wrappers around the CLI can exercise their error handling (hidden
+// --simulate-failures flag, testing only).
+type FailureSimulation struct {
+	Rate     float64 // Fraction of jobs that fail, from 0 to 1
+	Download bool    // Download the file before failing the job
+}
+
+// runSimulation is the --simulate-failures setting of the current invocation.
+var runSimulation FailureSimulation
+
+// parseFailureSimulation parses a spec such as "rate=0.2" or
+// "rate=0.2,download=true".
+func parseFailureSimulation(spec string) (FailureSimulation, error) {
+	var sim FailureSimulation
+	for _, field := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return sim, fmt.Errorf("%w: %q is not key=value", errInvalidSimulation, field)
+		}
+		var err error
+		switch key {
+		case "rate":
+			sim.Rate, err = strconv.ParseFloat(value, 64)
+			if err == nil && (sim.Rate < 0 || sim.Rate > 1) {
+				err = fmt.Errorf("%w: rate must be between 0 and 1", errInvalidSimulation)
+			}
+		case "download":
+			sim.Download, err = strconv.ParseBool(value)
+		default:
+			err = fmt.Errorf("%w: unknown key %q (want rate or download)", errInvalidSimulation, key)
+		}
+		if err != nil {
+			return sim, err
+		}
+	}
+	return sim, nil
+}
+
+// fail reports whether a job should be made to fail.
+func (s FailureSimulation) fail() bool {
+	return s.Rate > 0 && rand.Float64() < s.Rate
+}
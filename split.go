@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// defaultSplitThreshold is the smallest file --split downloads in chunks.
+// Below it the extra requests cost more than they save.
+const defaultSplitThreshold = 64 * 1024 * 1024
+
+// useSplit reports whether a file of the given size should be downloaded in
+// parallel chunks. A partial download being resumed is continued as a single
+// stream instead.
+func useSplit(fullPath string, size int64) bool {
+	if splitParts < 2 || size <= 0 || size < splitThreshold {
+		return false
+	}
+	return !(resume && fileExists(fullPath+partSuffix))
+}
+
+// downloadSplit downloads the file at url with splitParts concurrent range
+// requests, each writing its chunk at its offset in the .part file, and
+// renames the result into place (or writes the file in place with
+// --no-atomic). It returns errRangeIgnored if the server
+// doesn't honor range requests, so the caller can fall back to a single
+// stream.
+func downloadSplit(url, fullPath string, size int64, bar *pterm.ProgressbarPrinter) (int64, http.Header, error) {
+	target := downloadTarget(fullPath)
+	if err := mkdirOutput(filepath.Dir(target)); err != nil {
+		return 0, nil, err
+	}
+	acquireOpenFile()
+	defer releaseOpenFile()
+	file, err := openOutputFile(target, os.O_RDWR|os.O_CREATE|os.O_TRUNC, defaultFileMode)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		_ = os.Remove(target)
+		return 0, nil, err
+	}
+
+	if bar != nil {
+		bar.Current = 0
+	}
+	progress := &sharedProgress{bar: bar}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chunk := (size + int64(splitParts) - 1) / int64(splitParts)
+	errs := make([]error, splitParts)
+	headers := make([]http.Header, splitParts)
+	var wg sync.WaitGroup
+	for i := range splitParts {
+		from := int64(i) * chunk
+		to := min(from+chunk, size) - 1
+		if from > to {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if errs[i] != nil {
+					cancel()
+				}
+			}()
+			// The worker's recovery in runJob doesn't reach this goroutine.
+			defer recoverPanic(&errs[i], fmt.Sprintf("chunk %d-%d of %s", from, to, fullPath))
+			headers[i], errs[i] = downloadChunk(ctx, url, file, from, to, progress)
+		}()
+	}
+	wg.Wait()
+
+	err = errors.Join(errs...)
+	// Chunks aborted because another one failed only add noise.
+	if errors.Is(err, errRangeIgnored) {
+		err = errRangeIgnored
+	}
+	if err == nil {
+		err = syncForRename(file)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && target != fullPath {
+		err = os.Rename(target, fullPath)
+	}
+	if err != nil {
+		_ = os.Remove(target)
+		return 0, nil, err
+	}
+	// Every chunk is served from the same object, so any of them describes it.
+	return size, headers[0], nil
+}
+
+// downloadChunk fetches bytes from..to (inclusive) of url into file at the
+// same offset and returns the response headers.
+func downloadChunk(ctx context.Context, url string, file *os.File, from, to int64, progress *sharedProgress) (header http.Header, err error) {
+	byteRange := fmt.Sprintf("bytes=%d-%d", from, to)
+	start := time.Now()
+	status := 0
+	var written int64
+	defer func() {
+		runAudit.Download("download_chunk", url, byteRange, start, status, written, err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", byteRange)
+
+	resp, err := http.DefaultClient.Do(runHTTPDebug.Trace(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if isGzipEncoded(resp.Header) {
+			// The range is of the compressed body, which can't be
+			// decompressed piecewise; a single stream can.
+			return nil, errRangeIgnored
+		}
+	case http.StatusOK:
+		return nil, errRangeIgnored
+	default:
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	writer := io.NewOffsetWriter(file, from)
+	reader := io.TeeReader(io.LimitReader(resp.Body, to-from+1), progress)
+	written, err = io.CopyBuffer(writer, reader, make([]byte, bufferSize))
+	if err != nil {
+		return nil, err
+	}
+	if written != to-from+1 {
+		return nil, fmt.Errorf("%w: chunk at %d got %d of %d bytes", errSizeMismatch, from, written, to-from+1)
+	}
+	return resp.Header, nil
+}
+
+// sharedProgress lets several chunks advance the same bar.
+type sharedProgress struct {
+	mu  sync.Mutex
+	bar *pterm.ProgressbarPrinter
+}
+
+func (p *sharedProgress) Write(b []byte) (int, error) {
+	receivedBytes.Add(int64(len(b)))
+	if p.bar != nil {
+		p.mu.Lock()
+		// Deferred, so a panic while rendering doesn't leave the other
+		// chunks blocked on the lock.
+		defer p.mu.Unlock()
+		p.bar.Add(len(b))
+	}
+	return len(b), nil
+}
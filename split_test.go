@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// panicWriter panics on every write, standing in for a bug hit while a chunk
+// is being downloaded.
+type panicWriter struct{}
+
+func (panicWriter) Write([]byte) (int, error) { panic("render failed") }
+
+func TestDownloadSplitRecoversChunkPanic(t *testing.T) {
+	saved := splitParts
+	splitParts = 4
+	t.Cleanup(func() { splitParts = saved })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.parquet", time.Time{}, bytes.NewReader(testFileContent))
+	}))
+	defer srv.Close()
+	// Active without Start, so only the chunks' progress renders the bar.
+	bar := pterm.DefaultProgressbar.WithTotal(len(testFileContent)).WithWriter(panicWriter{})
+	bar.IsActive = true
+	fullPath := filepath.Join(t.TempDir(), "file.parquet")
+
+	_, _, err := downloadSplit(srv.URL, fullPath, int64(len(testFileContent)), bar)
+
+	if !errors.Is(err, errJobPanicked) {
+		t.Errorf("downloadSplit() = %v, want %v", err, errJobPanicked)
+	}
+	if fileExists(fullPath) || fileExists(fullPath+partSuffix) {
+		t.Error("a failed split download left a file behind")
+	}
+}
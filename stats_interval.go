@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// receivedBytes counts the bytes received by every download of the current
+// invocation, as they arrive, for the --stats-interval throughput.
+var receivedBytes atomic.Int64
+
+// startStatsReporter prints a status line to stderr every --stats-interval
+// while sched runs: jobs settled, throughput over the last interval and an
+// ETA for the batch from the average time per job so far. The returned
+// function stops it.
+func startStatsReporter(sched *Scheduler) (stop func()) {
+	if statsInterval <= 0 {
+		return func() {}
+	}
+	info := pterm.Info.WithWriter(os.Stderr)
+	start := time.Now()
+	startDone := sched.Done()
+	lastBytes := receivedBytes.Load()
+
+	ticker := time.NewTicker(statsInterval)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			settled, total := sched.Done(), sched.Total()
+			bytes := receivedBytes.Load()
+			rate := float64(bytes-lastBytes) / statsInterval.Seconds()
+			lastBytes = bytes
+
+			eta := "unknown"
+			if processed := settled - startDone; processed > 0 {
+				perJob := time.Since(start) / time.Duration(processed)
+				eta = (perJob * time.Duration(total-settled)).Round(time.Second).String()
+			}
+			info.Printfln("Stats: %d/%d jobs done, %s/s, ETA %s", settled, total, formatSize(int64(rate)), eta)
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-finished
+	}
+}
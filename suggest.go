@@ -0,0 +1,116 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// maxSuggestions is how many "did you mean" candidates are shown per name.
+const maxSuggestions = 3
+
+// reportUnmatched warns about requested exchanges and tokens that match no
+// file between start and end, suggesting close names that do exist. It only
+// suggests; the batch still uses the names as given.
+func reportUnmatched(start, end time.Time, configRules []ConfigRule) {
+	requestedExchanges := trimAll(exchanges)
+	requestedTokens := trimAll(tokens)
+	knownExchanges := make(map[string]bool)
+	knownPairs := make(map[string]bool)   // On any requested exchange
+	matchedPairs := make(map[string]bool) // Requested and found
+	for curr := start; !curr.After(end); curr = curr.AddDate(0, 0, 1) {
+		for ex, pairs := range getConfigForDate(configRules, curr) {
+			knownExchanges[ex] = true
+			if !contains(requestedExchanges, ex) {
+				continue
+			}
+			for _, pair := range pairs {
+				knownPairs[pair] = true
+				if contains(requestedTokens, pair) {
+					matchedPairs[pair] = true
+				}
+			}
+		}
+	}
+
+	for _, ex := range requestedExchanges {
+		if !knownExchanges[ex] {
+			warnUnmatched("Exchange", ex, knownExchanges)
+		}
+	}
+	for _, pair := range requestedTokens {
+		if !matchedPairs[pair] {
+			warnUnmatched("Token", pair, knownPairs)
+		}
+	}
+}
+
+func trimAll(names []string) []string {
+	trimmed := make([]string, len(names))
+	for i, name := range names {
+		trimmed[i] = strings.TrimSpace(name)
+	}
+	return trimmed
+}
+
+func warnUnmatched(kind, name string, known map[string]bool) {
+	msg := kind + " " + name + " matches no files in the requested range"
+	if suggestions := didYouMean(name, known); len(suggestions) > 0 {
+		msg += ". Did you mean " + strings.Join(suggestions, " or ") + "?"
+	}
+	pterm.Warning.Println(msg)
+}
+
+// didYouMean returns the known names closest to name by edit distance, at
+// most maxSuggestions of them. Only names a typo or two away are suggested,
+// and only those tied for the smallest distance.
+func didYouMean(name string, known map[string]bool) []string {
+	limit := max(1, min(2, len(name)/3))
+	type candidate struct {
+		name string
+		dist int
+	}
+	var candidates []candidate
+	for k := range known {
+		if d := levenshtein(strings.ToLower(name), strings.ToLower(k)); d <= limit {
+			candidates = append(candidates, candidate{k, d})
+		}
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return cmp.Or(cmp.Compare(a.dist, b.dist), cmp.Compare(a.name, b.name))
+	})
+	var names []string
+	for _, c := range candidates[:min(len(candidates), maxSuggestions)] {
+		if c.dist > candidates[0].dist {
+			break
+		}
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// levenshtein returns the number of single-character insertions, deletions
+// and substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
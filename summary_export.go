@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var summaryExportHeader = []string{
+	"timestamp", "type", "exchanges", "tokens", "start_date", "end_date",
+	"total", "success", "skipped", "failed", "bytes", "duration_seconds",
+}
+
+// exportSummary appends one row describing a finished run to the CSV file at
+// path, writing the header first if the file is new.
+func exportSummary(path string, stats RunStats, start, end time.Time, duration time.Duration) error {
+	_, err := os.Stat(path)
+	isNew := errors.Is(err, fs.ErrNotExist)
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if isNew {
+		if err := w.Write(summaryExportHeader); err != nil {
+			return err
+		}
+	}
+
+	row := []string{
+		time.Now().UTC().Format(time.RFC3339),
+		dataType,
+		strings.Join(exchanges, ","),
+		strings.Join(tokens, ","),
+		start.Format("2006-01-02"),
+		end.Format("2006-01-02"),
+		strconv.FormatInt(stats.Total, 10),
+		strconv.FormatInt(stats.Success, 10),
+		strconv.FormatInt(stats.Skipped, 10),
+		strconv.FormatInt(stats.Failed, 10),
+		strconv.FormatInt(stats.Bytes, 10),
+		strconv.FormatFloat(duration.Seconds(), 'f', 1, 64),
+	}
+	if err := w.Write(row); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
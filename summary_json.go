@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"atomicgo.dev/cursor"
+	"github.com/pterm/pterm"
+)
+
+// summaryJSON is the run summary printed by --json.
+type summaryJSON struct {
+	Total      int64         `json:"total"`
+	Success    int64         `json:"success"`
+	Skipped    int64         `json:"skipped"`
+	Failed     int64         `json:"failed"`
+	NotStarted int64         `json:"not_started"`
+	Missing    int64         `json:"missing"`
+	Refreshed  int64         `json:"refreshed"`
+	NotNewer   int64         `json:"not_newer"`
+	Retries    int64         `json:"retries"`
+	Recovered  int64         `json:"recovered"`
+	Bytes      int64         `json:"bytes"`
+	StopReason string        `json:"stop_reason,omitempty"`
+	Failures   []failureJSON `json:"failures"`
+	Jobs       []jobJSON     `json:"jobs"`
+	ByDate     []dateCounts  `json:"by_date,omitempty"` // With --summarize-by-date
+}
+
+type failureJSON struct {
+	Path     string `json:"path"`
+	Error    string `json:"error"`
+	Category string `json:"category"`
+	Retries  int    `json:"retries"`
+	jobTimeline
+}
+
+// jobJSON is the outcome and timeline of one job, in input order.
+type jobJSON struct {
+	Path            string  `json:"path"`
+	Status          string  `json:"status"`
+	Bytes           int64   `json:"bytes"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	jobTimeline
+}
+
+// redirectOutput sends all human-readable output, including the cursor
+// control sequences of progress bars, to w. pterm's printers copy the default
+// writer when the package is initialized, so each one is updated.
+func redirectOutput(w *os.File) {
+	pterm.SetDefaultOutput(w)
+	cursor.SetTarget(w)
+	for _, p := range []*pterm.PrefixPrinter{
+		&pterm.Info, &pterm.Success, &pterm.Warning, &pterm.Error,
+		&pterm.Fatal, &pterm.Debug, &pterm.Description,
+	} {
+		p.Writer = w
+	}
+	pterm.DefaultSection.Writer = w
+	pterm.DefaultHeader.Writer = w
+	pterm.DefaultTable.Writer = w
+	pterm.DefaultBasicText.Writer = w
+	pterm.DefaultMultiPrinter.Writer = w
+}
+
+// printSummaryJSON writes the summary as one line of JSON to stdout.
+func printSummaryJSON(stats RunStats) {
+	summary := summaryJSON{
+		Total:      stats.Total,
+		Success:    stats.Success,
+		Skipped:    stats.Skipped,
+		Failed:     stats.Failed,
+		NotStarted: stats.NotStarted,
+		Missing:    stats.Missing,
+		Refreshed:  stats.Refreshed,
+		NotNewer:   stats.NotNewer,
+		Retries:    stats.Retries,
+		Recovered:  stats.Recovered,
+		Bytes:      stats.Bytes,
+		StopReason: stats.StopReason,
+		Failures:   []failureJSON{},
+		Jobs:       make([]jobJSON, 0, len(stats.Results)),
+	}
+	for _, result := range stats.Results {
+		if result.Status == StatusFailed {
+			summary.Failures = append(summary.Failures, failureJSON{
+				Path:        result.Path,
+				Error:       fmt.Sprint(result.Err),
+				Category:    classifyError(result.Err),
+				Retries:     result.Retries,
+				jobTimeline: newJobTimeline(result),
+			})
+		}
+		summary.Jobs = append(summary.Jobs, jobJSON{
+			Path:            result.Path,
+			Status:          result.Status.String(),
+			Bytes:           result.Bytes,
+			DurationSeconds: result.Duration.Seconds(),
+			jobTimeline:     newJobTimeline(result),
+		})
+	}
+	if summarizeByDate {
+		summary.ByDate = countByDate(stats)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(summary)
+}
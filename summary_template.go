@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// builtinSummaryTemplates are the --summary-template values that name a
+// template instead of a file.
+var builtinSummaryTemplates = map[string]string{
+	"default": `{{.Type}} download finished: {{.Start}} to {{.End}}
+Total: {{.Total}}, downloaded: {{.Success}}, already present: {{.Skipped}}, failed: {{.Failed}}{{if .Missing}}, missing: {{.Missing}}{{end}}{{if .NotStarted}}, not started: {{.NotStarted}}{{end}}
+Data: {{size .Bytes}} in {{.Duration}}{{if .Retries}}
+Retries: {{.Retries}} ({{.Recovered}} recovered){{end}}{{if .StopReason}}
+Stopped early: {{.StopReason}}{{end}}
+{{range .Failures}}FAILED {{.Path}}: {{.Error}}
+{{end}}`,
+
+	"slack": `{{if .Failed}}:warning:{{else}}:white_check_mark:{{end}} *{{.Type}} download {{if .StopReason}}stopped{{else}}finished{{end}}* ({{.Start}} to {{.End}})
+>*Files:* {{.Total}} total, {{.Success}} downloaded, {{.Skipped}} already present, {{.Failed}} failed
+>*Data:* {{size .Bytes}} in {{.Duration}}
+{{range .ByExchange}}• ` + "`{{.Exchange}}`" + `: {{.Succeeded}}/{{.Files}}{{if .Failed}}, {{.Failed}} failed{{end}}{{if .Missing}}, {{.Missing}} missing{{end}}
+{{end}}{{if .Failures}}*Failures:*
+{{range .Failures}}• ` + "`{{.Path}}`" + `: {{.Error}}
+{{end}}{{end}}`,
+
+	"email": `Subject: [terminal-cli] {{.Type}} {{.Start}} to {{.End}}: {{if .Failed}}{{.Failed}} failed{{else}}all {{.Total}} files OK{{end}}
+
+The {{.Type}} download of {{.Start}} to {{.End}} {{if .StopReason}}stopped early ({{.StopReason}}){{else}}finished{{end}} after {{.Duration}}.
+
+  Total files:      {{.Total}}
+  Downloaded:       {{.Success}}
+  Already present:  {{.Skipped}}
+  Failed:           {{.Failed}}{{if .Missing}}
+  Missing:          {{.Missing}}{{end}}
+  Data transferred: {{size .Bytes}}
+
+By exchange:
+{{range .ByExchange}}  {{printf "%-12s" .Exchange}} {{.Succeeded}} of {{.Files}} succeeded{{if .Failed}}, {{.Failed}} failed{{end}}{{if .Missing}}, {{.Missing}} missing{{end}}
+{{end}}{{if .Failures}}
+Failed files:
+{{range .Failures}}  {{.Path}}
+    {{.Error}} ({{.Category}})
+{{end}}{{end}}`,
+}
+
+// runSummaryTemplate is the parsed --summary-template, nil if none is set.
+var runSummaryTemplate *template.Template
+
+// loadSummaryTemplate parses a built-in template by name, or else the
+// template file at nameOrPath.
+func loadSummaryTemplate(nameOrPath string) (*template.Template, error) {
+	text, ok := builtinSummaryTemplates[nameOrPath]
+	if !ok {
+		data, err := os.ReadFile(nameOrPath)
+		if err != nil {
+			names := make([]string, 0, len(builtinSummaryTemplates))
+			for name := range builtinSummaryTemplates {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("--summary-template %q is neither a built-in template (%s) nor a readable file: %w",
+				nameOrPath, strings.Join(names, ", "), err)
+		}
+		text = string(data)
+	}
+	return template.New("summary").Funcs(template.FuncMap{
+		"size": func(bytes int64) string { return fmt.Sprintf("%.2f MB", float64(bytes)/1024/1024) },
+		"join": strings.Join,
+	}).Parse(text)
+}
+
+// exchangeCounts is the outcome of one exchange's jobs.
+type exchangeCounts struct {
+	Exchange string
+	outcomeCounts
+	Bytes int64
+}
+
+// summaryTemplateData is what a --summary-template is executed with.
+type summaryTemplateData struct {
+	Type       string
+	Exchanges  []string
+	Tokens     []string
+	Start, End string // YYYY-MM-DD
+
+	Total, Success, Skipped, Failed int64
+	NotStarted, Missing, Refreshed  int64
+	NotNewer, Retries, Recovered    int64
+	Bytes                           int64
+	Duration                        time.Duration
+	StopReason                      string
+
+	Failures   []failureJSON
+	ByDate     []dateCounts
+	ByExchange []exchangeCounts
+}
+
+// printSummaryTemplate renders the --summary-template to stdout once a run,
+// or a --watch pass, is over.
+func printSummaryTemplate(stats RunStats, start, end time.Time, duration time.Duration) {
+	if runSummaryTemplate == nil {
+		return
+	}
+	data := summaryTemplateData{
+		Type:       dataType,
+		Exchanges:  trimAll(exchanges),
+		Tokens:     trimAll(tokens),
+		Start:      start.Format(serverDateFormat),
+		End:        end.Format(serverDateFormat),
+		Total:      stats.Total,
+		Success:    stats.Success,
+		Skipped:    stats.Skipped,
+		Failed:     stats.Failed,
+		NotStarted: stats.NotStarted,
+		Missing:    stats.Missing,
+		Refreshed:  stats.Refreshed,
+		NotNewer:   stats.NotNewer,
+		Retries:    stats.Retries,
+		Recovered:  stats.Recovered,
+		Bytes:      stats.Bytes,
+		Duration:   duration.Round(time.Second),
+		StopReason: stats.StopReason,
+		ByDate:     countByDate(stats),
+		ByExchange: countByExchange(stats),
+	}
+	for _, result := range stats.Results {
+		if result.Status == StatusFailed {
+			data.Failures = append(data.Failures, failureJSON{
+				Path:        result.Path,
+				Error:       fmt.Sprint(result.Err),
+				Category:    classifyError(result.Err),
+				Retries:     result.Retries,
+				jobTimeline: newJobTimeline(result),
+			})
+		}
+	}
+	if err := runSummaryTemplate.Execute(os.Stdout, data); err != nil {
+		pterm.Warning.Printf("Failed to render --summary-template: %v\n", err)
+	}
+}
+
+// countByExchange aggregates the results by exchange, in alphabetical order.
+func countByExchange(stats RunStats) []exchangeCounts {
+	byExchange := make(map[string]*exchangeCounts)
+	for _, result := range stats.Results {
+		c := byExchange[result.Exchange]
+		if c == nil {
+			c = &exchangeCounts{Exchange: result.Exchange}
+			byExchange[result.Exchange] = c
+		}
+		c.add(result)
+		c.Bytes += result.Bytes
+	}
+
+	counts := make([]exchangeCounts, 0, len(byExchange))
+	for _, c := range byExchange {
+		counts = append(counts, *c)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Exchange < counts[j].Exchange })
+	return counts
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// Table styles accepted by --table-style.
+const (
+	tableStyleDefault  = "default"
+	tableStyleCompact  = "compact"
+	tableStyleMarkdown = "markdown"
+)
+
+var tableStyle string
+
+var errUnknownTableStyle = errors.New("unknown table style")
+
+func validateTableStyle(style string) error {
+	switch style {
+	case tableStyleDefault, tableStyleCompact, tableStyleMarkdown:
+		return nil
+	}
+	return fmt.Errorf("%w: %s (supported: %s, %s, %s)", errUnknownTableStyle, style,
+		tableStyleDefault, tableStyleCompact, tableStyleMarkdown)
+}
+
+// renderTable renders a table in the --table-style. The default style keeps
+// the table's own look; compact drops borders and separators, and markdown
+// prints a GitHub-flavored table without colors.
+func renderTable(table *pterm.TablePrinter) {
+	switch tableStyle {
+	case tableStyleCompact:
+		_ = table.WithBoxed(false).WithSeparator("  ").WithHeaderRowSeparator("").Render()
+	case tableStyleMarkdown:
+		pterm.Print(markdownTable(table.Data, table.HasHeader))
+	default:
+		_ = table.Render()
+	}
+}
+
+// markdownTable formats data as a GitHub-flavored markdown table. Tables
+// without a header row get an empty one, since markdown requires it. Blank
+// spacer rows are dropped and line breaks within cells become <br>.
+func markdownTable(data pterm.TableData, hasHeader bool) string {
+	if len(data) == 0 {
+		return ""
+	}
+	cols := 0
+	for _, row := range data {
+		cols = max(cols, len(row))
+	}
+
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		sb.WriteString("|")
+		for i := range cols {
+			cell := ""
+			if i < len(row) {
+				cell = pterm.RemoveColorFromString(row[i])
+				cell = strings.ReplaceAll(cell, "|", `\|`)
+				cell = strings.ReplaceAll(cell, "\n", "<br>")
+			}
+			sb.WriteString(" " + strings.TrimSpace(cell) + " |")
+		}
+		sb.WriteString("\n")
+	}
+
+	rows := data
+	if hasHeader {
+		writeRow(data[0])
+		rows = data[1:]
+	} else {
+		writeRow(nil)
+	}
+	sb.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+	for _, row := range rows {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		writeRow(row)
+	}
+	return sb.String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// tokenMapping renames server pair names to local ones (--token-mapping).
+// Only local paths use the mapped names; the server is always queried with
+// the original pair.
+var tokenMapping map[string]string
+
+// loadTokenMapping reads a JSON object mapping server pair names to local
+// names.
+func loadTokenMapping(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for from, to := range mapping {
+		if strings.TrimSpace(to) == "" {
+			return nil, fmt.Errorf("%s: empty local name for %q", path, from)
+		}
+	}
+	return mapping, nil
+}
+
+// localPairName returns the local name of a server pair.
+func localPairName(pair string) string {
+	if mapped, ok := tokenMapping[pair]; ok {
+		return mapped
+	}
+	return pair
+}
+
+// reportUnmappedPairs lists the pairs of jobs that --token-mapping doesn't
+// cover and that therefore keep their server names.
+func reportUnmappedPairs(jobs []Job) {
+	if tokenMapping == nil {
+		return
+	}
+	var unmapped []string
+	for _, job := range jobs {
+		if _, ok := tokenMapping[job.Pair]; !ok && !slices.Contains(unmapped, job.Pair) {
+			unmapped = append(unmapped, job.Pair)
+		}
+	}
+	if len(unmapped) > 0 {
+		slices.Sort(unmapped)
+		pterm.Warning.Printf("Not in the token mapping, keeping server names: %s\n", strings.Join(unmapped, ", "))
+	}
+}
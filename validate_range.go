@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	validateType        string
+	validateStartDate   string
+	validateEndDate     string
+	validateExchanges   []string
+	validateTokens      []string
+	validateSampleEvery int
+)
+
+// maxGapsShown is how many missing files validate-range lists by name.
+const maxGapsShown = 20
+
+func newValidateRangeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate-range",
+		Short: "Sample a date range for data availability without downloading",
+		Long: `Fetches the download links of the files on a sample of the dates in a range,
+by default the first, middle and last date, and reports the share that the
+server has and which sampled files are missing. Nothing is downloaded, so it
+is a cheap check before committing to a long download.`,
+		Run: runValidateRange,
+	}
+	cmd.Flags().StringVar(&validateType, "type", "trade", "Data type: "+strings.Join(supportedDataTypes(), ", "))
+	cmd.Flags().StringVar(&validateStartDate, "start-date", "", "First date of the range (YYYY-MM-DD)")
+	cmd.Flags().StringVar(&validateEndDate, "end-date", "", "Last date of the range (YYYY-MM-DD, default yesterday)")
+	cmd.Flags().StringSliceVar(&validateExchanges, "exchanges", nil, "Exchanges to check")
+	cmd.Flags().StringSliceVar(&validateTokens, "tokens", nil, "Only check these pairs (default all pairs of the exchanges)")
+	cmd.Flags().IntVar(&validateSampleEvery, "sample-every", 0, "Check every Nth date of the range, plus the last (0 = first, middle and last only)")
+	_ = cmd.MarkFlagRequired("start-date")
+	_ = cmd.MarkFlagRequired("exchanges")
+	return cmd
+}
+
+// sampleResult is the availability of the files of one sampled date.
+type sampleResult struct {
+	date      time.Time
+	relPaths  []string
+	missing   []string
+	errs      []error
+	available int
+}
+
+func runValidateRange(cmd *cobra.Command, args []string) {
+	if _, ok := dataTypeFileParts[validateType]; !ok {
+		pterm.Error.Printf("Unknown data type: %s. Supported types: %s\n", validateType, strings.Join(supportedDataTypes(), ", "))
+		os.Exit(1)
+	}
+	if validateSampleEvery < 0 {
+		pterm.Error.Println("--sample-every must not be negative")
+		os.Exit(1)
+	}
+	start, err := time.Parse(serverDateFormat, validateStartDate)
+	if err != nil {
+		pterm.Error.Printf("Invalid start date: %v\n", err)
+		os.Exit(1)
+	}
+	end := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	if validateEndDate != "" {
+		end, err = time.Parse(serverDateFormat, validateEndDate)
+		if err != nil {
+			pterm.Error.Printf("Invalid end date: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if end.Before(start) {
+		pterm.Error.Println("End date must be on or after the start date")
+		os.Exit(1)
+	}
+
+	rules, err := loadConfigRules(validateType)
+	if err != nil {
+		pterm.Error.Printf("Failed to load metadata configurations: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := loadUserConfig(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if _, err := loadAPIKeySource(cmd); err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("API_KEY")
+	}
+	if err := checkAPIKey(apiKey); err != nil {
+		pterm.Warning.Printf("%v; requests will likely be rejected\n", err)
+	}
+
+	var dates []time.Time
+	expected := 0
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d)
+		expected += len(validateFiles(getConfigForDate(rules, d), d))
+	}
+	sampled := sampleDates(dates, validateSampleEvery)
+
+	pterm.DefaultSection.Println("Validating Range")
+	pterm.Info.Printf("Type: %s\n", validateType)
+	pterm.Info.Printf("Range: %s to %s (%d dates, %d files listed in the metadata)\n",
+		start.Format(serverDateFormat), end.Format(serverDateFormat), len(dates), expected)
+	pterm.Info.Printf("Sampled dates: %d\n", len(sampled))
+	pterm.Println()
+
+	var results []sampleResult
+	for _, date := range sampled {
+		relPaths := validateFiles(getConfigForDate(rules, date), date)
+		spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Checking %s (%d files)...", date.Format(serverDateFormat), len(relPaths)))
+		results = append(results, probeSample(date, relPaths))
+		_ = spinner.Stop()
+	}
+	printValidateRange(results, expected)
+}
+
+// validateFiles lists the server paths of the requested exchanges and tokens
+// that config has on date, in a stable order.
+func validateFiles(config map[string][]string, date time.Time) []string {
+	var relPaths []string
+	for _, ex := range slices.Sorted(slices.Values(trimAll(validateExchanges))) {
+		for _, pair := range slices.Sorted(slices.Values(config[ex])) {
+			if len(validateTokens) > 0 && !contains(trimAll(validateTokens), pair) {
+				continue
+			}
+			relPaths = append(relPaths, getRelativePath(ex, pair, validateType, date))
+		}
+	}
+	return relPaths
+}
+
+// sampleDates picks every nth date plus the last one, or with n = 0 the
+// first, middle and last date.
+func sampleDates(dates []time.Time, n int) []time.Time {
+	var indexes []int
+	if n == 0 {
+		indexes = []int{0, len(dates) / 2, len(dates) - 1}
+	} else {
+		for i := 0; i < len(dates); i += n {
+			indexes = append(indexes, i)
+		}
+		indexes = append(indexes, len(dates)-1)
+	}
+	slices.Sort(indexes)
+	var sampled []time.Time
+	for _, i := range slices.Compact(indexes) {
+		sampled = append(sampled, dates[i])
+	}
+	return sampled
+}
+
+// probeSample fetches the download link of every file of one date. A 404
+// means the file is missing; other errors say nothing about availability
+// and are kept apart.
+func probeSample(date time.Time, relPaths []string) sampleResult {
+	result := sampleResult{date: date, relPaths: relPaths}
+	var mu sync.Mutex
+	forEachParallel(len(relPaths), parallelism, func(idx int) {
+		_, _, err := fetchDownloadLink(apiKey, relPaths[idx])
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err == nil:
+			result.available++
+		case errors.Is(err, errFileNotFound):
+			result.missing = append(result.missing, relPaths[idx])
+		default:
+			result.errs = append(result.errs, fmt.Errorf("%s: %w", relPaths[idx], err))
+		}
+	})
+	slices.Sort(result.missing)
+	return result
+}
+
+func printValidateRange(results []sampleResult, expected int) {
+	tableData := [][]string{{"Date", "Files", "Available", "Missing", "Errors", "Coverage"}}
+	var probed, available int
+	var gaps []string
+	var errs []error
+	var unlisted []string
+	for _, r := range results {
+		checked := r.available + len(r.missing)
+		probed += checked
+		available += r.available
+		gaps = append(gaps, r.missing...)
+		errs = append(errs, r.errs...)
+		coverage := "-"
+		switch {
+		case len(r.relPaths) == 0:
+			unlisted = append(unlisted, r.date.Format(serverDateFormat))
+		case checked > 0:
+			coverage = fmt.Sprintf("%.1f%%", 100*float64(r.available)/float64(checked))
+		}
+		tableData = append(tableData, []string{
+			r.date.Format(serverDateFormat),
+			fmt.Sprint(len(r.relPaths)),
+			fmt.Sprint(r.available),
+			fmt.Sprint(len(r.missing)),
+			fmt.Sprint(len(r.errs)),
+			coverage,
+		})
+	}
+	renderTable(pterm.DefaultTable.
+		WithHasHeader().
+		WithBoxed().
+		WithData(tableData))
+	pterm.Println()
+
+	if len(unlisted) > 0 {
+		pterm.Warning.Printf("The metadata lists none of the requested files on: %s\n", strings.Join(unlisted, ", "))
+	}
+	if len(gaps) > 0 {
+		pterm.Warning.Printf("Missing on the server (%d):\n", len(gaps))
+		for _, relPath := range gaps[:min(len(gaps), maxGapsShown)] {
+			pterm.Printf("  %s\n", relPath)
+		}
+		if len(gaps) > maxGapsShown {
+			pterm.Printf("  ... and %d more\n", len(gaps)-maxGapsShown)
+		}
+	}
+	for _, err := range errs {
+		pterm.Warning.Printf("Could not check %v\n", err)
+	}
+	if probed == 0 {
+		pterm.Error.Println("No sampled file could be checked; coverage is unknown.")
+		os.Exit(1)
+	}
+
+	coverage := float64(available) / float64(probed)
+	pterm.Info.Printf("Estimated coverage: %.1f%% (%d of %d sampled files available)\n", 100*coverage, available, probed)
+	pterm.Info.Printf("Estimated available in the range: ~%d of %d listed files\n", int(coverage*float64(expected)+0.5), expected)
+	if available == probed {
+		pterm.Success.Println("Every sampled file is on the server.")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// runWatchMode repeatedly downloads every file available between start and
+// end (or today, when no end date was given), sleeping pollInterval between
+// passes. Files that were downloaded or already present are remembered so
+// later passes only attempt what is still outstanding.
+func runWatchMode(start, end time.Time, configRules []ConfigRule) {
+	fetched := make(map[string]bool)
+	confirmed := false
+	defer closeIngest()
+	stopSignals := closeIngestOnSignal()
+	defer stopSignals()
+
+	for {
+		passEnd := end
+		if endDate == "" {
+			passEnd = today()
+		}
+
+		var pending []Job
+		for _, job := range buildJobs(start, passEnd, configRules) {
+			if !fetched[job.FullPath] {
+				pending = append(pending, job)
+			}
+		}
+		numberJobs(pending)
+
+		if len(pending) == 0 {
+			pterm.Info.Printf("No new files up to %s.\n", passEnd.Format("2006-01-02"))
+		} else {
+			printJobSummary(pending)
+			if !confirmed {
+				confirmOrExit(len(pending))
+				startDeadline()
+				confirmed = true
+			}
+
+			pterm.Println()
+			passStart := time.Now()
+			stats := runDownloads(pending)
+			printRunSummary(stats)
+			printSummaryTemplate(stats, start, passEnd, time.Since(passStart))
+			writeSummaryExport(stats, start, passEnd, time.Since(passStart))
+			saveLinkCache()
+			saveManifest()
+			runMirrors.Report()
+			for i, result := range stats.Results {
+				if result.Status != StatusFailed && result.Status != StatusNotStarted {
+					fetched[pending[i].FullPath] = true
+				}
+			}
+		}
+
+		wait := pollInterval
+		if !runDeadline.IsZero() {
+			remaining := time.Until(runDeadline)
+			if remaining <= 0 {
+				pterm.Info.Printf("Stopping: reached --max-duration of %s.\n", maxDuration)
+				return
+			}
+			wait = min(wait, remaining)
+		}
+
+		pterm.Info.Printf("Next check at %s (polling every %s).\n",
+			time.Now().Add(wait).Format(time.TimeOnly), pollInterval)
+		time.Sleep(wait)
+	}
+}
+
+// today returns the current date at midnight in the --timezone location,
+// matching how --start-date and --end-date are parsed.
+func today() time.Time {
+	now := time.Now().In(location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+}